@@ -0,0 +1,306 @@
+package logged
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	overflowBlock = iota
+	overflowDropNewest
+	overflowDropOldest
+	overflowDropBelow
+)
+
+// OverflowPolicy represents the behaviour of a handler when its queue is full.
+type OverflowPolicy struct {
+	mode int
+	lvl  Level
+}
+
+// List of predefined overflow policies.
+var (
+	// OverflowBlock waits for space in the queue.
+	OverflowBlock = OverflowPolicy{mode: overflowBlock}
+	// OverflowDropNewest drops the message being queued.
+	OverflowDropNewest = OverflowPolicy{mode: overflowDropNewest}
+	// OverflowDropOldest drops the oldest queued message to make space.
+	OverflowDropOldest = OverflowPolicy{mode: overflowDropOldest}
+)
+
+// OverflowDropBelow drops messages less severe than lvl, waiting for space in
+// the queue for all other messages.
+func OverflowDropBelow(lvl Level) OverflowPolicy {
+	return OverflowPolicy{mode: overflowDropBelow, lvl: lvl}
+}
+
+// AsyncStats contains the statistics of an async handler.
+type AsyncStats struct {
+	// Queued is the number of messages waiting to be written.
+	Queued int
+	// Dropped is the number of messages dropped due to a full queue.
+	Dropped uint64
+}
+
+// AsyncOption represents an option for the async handler.
+type AsyncOption func(*asyncHandler)
+
+// AsyncDrainTimeout sets the maximum time Flush and Close wait for the
+// queue to drain. Shutdown waits until its context is done instead.
+func AsyncDrainTimeout(d time.Duration) AsyncOption {
+	return func(h *asyncHandler) {
+		h.timeout = d
+	}
+}
+
+type asyncEntry struct {
+	msg   string
+	lvl   Level
+	ctx   []interface{}
+	flush chan error
+}
+
+type asyncHandler struct {
+	h       Handler
+	policy  OverflowPolicy
+	timeout time.Duration
+
+	ch      chan asyncEntry
+	dropped atomic.Uint64
+
+	once        sync.Once
+	abandonOnce sync.Once
+	done        chan struct{}
+	abandon     chan struct{}
+	stopped     chan struct{}
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// AsyncHandler returns a handler that queues messages, writing them to the
+// wrapped handler from a background goroutine. When the queue is full,
+// messages are handled according to the overflow policy.
+//
+// AsyncHandler panics if the queue size is less than 1.
+func AsyncHandler(h Handler, queueSize int, policy OverflowPolicy, opts ...AsyncOption) Handler {
+	if queueSize < 1 {
+		panic(fmt.Sprintf("log: invalid async queue size: %d", queueSize))
+	}
+
+	ah := &asyncHandler{
+		h:       h,
+		policy:  policy,
+		timeout: 5 * time.Second,
+		ch:      make(chan asyncEntry, queueSize),
+		done:    make(chan struct{}),
+		abandon: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(ah)
+	}
+
+	go ah.run()
+
+	return ah
+}
+
+func (h *asyncHandler) run() {
+	defer close(h.stopped)
+
+	for {
+		select {
+		case e := <-h.ch:
+			h.handle(e)
+
+		case <-h.done:
+			for {
+				select {
+				case <-h.abandon:
+					return
+				case e := <-h.ch:
+					h.handle(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (h *asyncHandler) handle(e asyncEntry) {
+	if e.flush != nil {
+		e.flush <- tryFlush(h.h)
+		return
+	}
+
+	h.h.Log(e.msg, e.lvl, e.ctx)
+}
+
+// Log write the log message.
+func (h *asyncHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	select {
+	case <-h.done:
+		return
+	default:
+	}
+
+	// The context is copied as the caller may reuse it once Log returns
+	e := asyncEntry{msg: msg, lvl: lvl, ctx: merge(ctx, nil)}
+
+	switch h.policy.mode {
+	case overflowDropNewest:
+		h.tryEnqueue(e)
+
+	case overflowDropOldest:
+		for {
+			select {
+			case h.ch <- e:
+				return
+			default:
+			}
+
+			select {
+			case old := <-h.ch:
+				// A flush marker at the head of the queue has nothing
+				// before it left to wait for.
+				if old.flush != nil {
+					old.flush <- nil
+					continue
+				}
+				h.dropped.Add(1)
+			default:
+			}
+		}
+
+	case overflowDropBelow:
+		if lvl > h.policy.lvl {
+			h.tryEnqueue(e)
+			return
+		}
+		h.enqueue(e)
+
+	default:
+		h.enqueue(e)
+	}
+}
+
+// tryEnqueue queues the entry if there is space, counting it as dropped otherwise.
+func (h *asyncHandler) tryEnqueue(e asyncEntry) bool {
+	select {
+	case h.ch <- e:
+		return true
+	default:
+		h.dropped.Add(1)
+		return false
+	}
+}
+
+// enqueue waits to queue the entry.
+func (h *asyncHandler) enqueue(e asyncEntry) {
+	select {
+	case h.ch <- e:
+	case <-h.done:
+		h.dropped.Add(1)
+	}
+}
+
+// Stats returns the statistics of the handler.
+func (h *asyncHandler) Stats() AsyncStats {
+	return AsyncStats{
+		Queued:  len(h.ch),
+		Dropped: h.dropped.Load(),
+	}
+}
+
+// Enabled returns true if the wrapped handler writes messages of the level.
+func (h *asyncHandler) Enabled(lvl Level) bool {
+	return enabled(h.h, lvl)
+}
+
+// Flush waits until all messages queued before the call have been written
+// and the wrapped handler has been flushed, or the drain timeout has passed.
+func (h *asyncHandler) Flush() error {
+	// Once closed, nothing drains the queue, so a marker would never be written
+	select {
+	case <-h.done:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+
+	marker := make(chan error, 1)
+	select {
+	case h.ch <- asyncEntry{flush: marker}:
+	case <-h.done:
+		return nil
+	case <-timer.C:
+		return errors.New("log: timed out flushing async handler")
+	}
+
+	select {
+	case err := <-marker:
+		return err
+	case <-timer.C:
+		return errors.New("log: timed out flushing async handler")
+	}
+}
+
+// Close stops the handler, waiting up to the drain timeout for queued
+// messages to be written, and closes the wrapped handler.
+func (h *asyncHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	return h.Shutdown(ctx)
+}
+
+// Shutdown stops the handler, waiting for queued messages to be written
+// until the context is done, and shuts down the wrapped handler. The number
+// of messages left unwritten is reported in the error.
+//
+// If the context is done first, the wrapped handler is closed in the
+// background once the message being written, if any, has been written.
+// Errors closing it are reported to the package error handler.
+func (h *asyncHandler) Shutdown(ctx context.Context) error {
+	h.once.Do(func() {
+		close(h.done)
+	})
+
+	select {
+	case <-h.stopped:
+		return h.shutdownWrapped(func() error {
+			return tryShutdown(ctx, h.h)
+		})
+
+	case <-ctx.Done():
+		h.abandonOnce.Do(func() {
+			close(h.abandon)
+
+			go func() {
+				<-h.stopped
+				if err := h.shutdownWrapped(func() error { return tryClose(h.h) }); err != nil {
+					reportError(err)
+				}
+			}()
+		})
+		return fmt.Errorf("log: shutdown abandoned %d messages: %w", len(h.ch), ctx.Err())
+	}
+}
+
+// shutdownWrapped shuts down the wrapped handler with fn, only once.
+func (h *asyncHandler) shutdownWrapped(fn func() error) error {
+	h.shutdownOnce.Do(func() {
+		h.shutdownErr = fn()
+	})
+
+	return h.shutdownErr
+}
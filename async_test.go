@@ -0,0 +1,250 @@
+package logged_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type blockingHandler struct {
+	RecordingHandler
+
+	release chan struct{}
+}
+
+func (h *blockingHandler) Log(msg string, lvl logged.Level, ctx []interface{}) {
+	<-h.release
+	h.RecordingHandler.Log(msg, lvl, ctx)
+}
+
+func TestAsyncHandler(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.AsyncHandler(rec, 10, logged.OverflowBlock)
+
+	ctx := []interface{}{"a", 1}
+	h.Log("test", logged.Info, ctx)
+	ctx[1] = 2
+	h.(io.Closer).Close()
+
+	assert.Equal(t, []LogLine{{Msg: "test", Lvl: logged.Info, Ctx: []interface{}{"a", 1}}}, rec.Lines())
+}
+
+func TestAsyncHandler_Flush(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.AsyncHandler(rec, 10, logged.OverflowBlock)
+	defer h.(io.Closer).Close()
+
+	h.Log("test", logged.Info, []interface{}{})
+	err := h.(logged.Flusher).Flush()
+
+	assert.NoError(t, err)
+	assert.Len(t, rec.Lines(), 1)
+}
+
+func TestAsyncHandler_CallsUnderlyingFlush(t *testing.T) {
+	testHandler := &FlushableHandler{}
+	h := logged.AsyncHandler(testHandler, 10, logged.OverflowBlock)
+	defer h.(io.Closer).Close()
+
+	err := h.(logged.Flusher).Flush()
+
+	assert.NoError(t, err)
+	assert.True(t, testHandler.FlushCalled)
+}
+
+func TestAsyncHandler_FlushTimeout(t *testing.T) {
+	bh := &blockingHandler{release: make(chan struct{})}
+	h := logged.AsyncHandler(bh, 10, logged.OverflowBlock, logged.AsyncDrainTimeout(10*time.Millisecond))
+
+	h.Log("test", logged.Info, []interface{}{})
+	err := h.(logged.Flusher).Flush()
+
+	assert.Error(t, err)
+
+	close(bh.release)
+	h.(io.Closer).Close()
+}
+
+func TestAsyncHandler_Overflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  logged.OverflowPolicy
+		want    []string
+		dropped uint64
+	}{
+		{
+			name:    "DropNewest",
+			policy:  logged.OverflowDropNewest,
+			want:    []string{"1", "2", "3"},
+			dropped: 2,
+		},
+		{
+			name:    "DropOldest",
+			policy:  logged.OverflowDropOldest,
+			want:    []string{"1", "4", "5"},
+			dropped: 2,
+		},
+		{
+			name:    "DropBelow",
+			policy:  logged.OverflowDropBelow(logged.Error),
+			want:    []string{"1", "2", "3"},
+			dropped: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &blockingHandler{release: make(chan struct{})}
+			h := logged.AsyncHandler(bh, 2, tt.policy)
+
+			h.Log("1", logged.Info, []interface{}{})
+			// Wait for the worker to pick up the first message
+			time.Sleep(5 * time.Millisecond)
+			for _, msg := range []string{"2", "3", "4", "5"} {
+				h.Log(msg, logged.Info, []interface{}{})
+			}
+
+			stats := h.(interface{ Stats() logged.AsyncStats }).Stats()
+			assert.Equal(t, 2, stats.Queued)
+			assert.Equal(t, tt.dropped, stats.Dropped)
+
+			close(bh.release)
+			h.(io.Closer).Close()
+
+			var got []string
+			for _, l := range bh.Lines() {
+				got = append(got, l.Msg)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAsyncHandler_DropBelowBlocksSevere(t *testing.T) {
+	bh := &blockingHandler{release: make(chan struct{})}
+	h := logged.AsyncHandler(bh, 1, logged.OverflowDropBelow(logged.Error))
+
+	h.Log("1", logged.Info, []interface{}{})
+	time.Sleep(5 * time.Millisecond)
+	h.Log("2", logged.Info, []interface{}{})
+
+	written := make(chan struct{})
+	go func() {
+		h.Log("3", logged.Error, []interface{}{})
+		close(written)
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("Expected severe message to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(bh.release)
+	<-written
+	h.(io.Closer).Close()
+
+	assert.Len(t, bh.Lines(), 3)
+}
+
+func TestAsyncHandler_CloseTimeout(t *testing.T) {
+	bh := &blockingHandler{release: make(chan struct{})}
+	h := logged.AsyncHandler(bh, 10, logged.OverflowBlock, logged.AsyncDrainTimeout(10*time.Millisecond))
+
+	h.Log("1", logged.Info, []interface{}{})
+	h.Log("2", logged.Info, []interface{}{})
+	time.Sleep(5 * time.Millisecond)
+
+	err := h.(io.Closer).Close()
+
+	assert.EqualError(t, err, "log: shutdown abandoned 1 messages: context deadline exceeded")
+	close(bh.release)
+}
+
+func TestAsyncHandler_Shutdown(t *testing.T) {
+	bh := &blockingHandler{release: make(chan struct{})}
+	h := logged.AsyncHandler(bh, 10, logged.OverflowBlock)
+
+	h.Log("1", logged.Info, []interface{}{})
+	h.Log("2", logged.Info, []interface{}{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := h.(logged.Shutdowner).Shutdown(ctx)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(bh.release)
+}
+
+type closingBlockingHandler struct {
+	blockingHandler
+
+	closed chan struct{}
+}
+
+func (h *closingBlockingHandler) Close() error {
+	close(h.closed)
+	return nil
+}
+
+func TestAsyncHandler_ClosesWrappedHandlerAfterAbandonedShutdown(t *testing.T) {
+	bh := &closingBlockingHandler{blockingHandler: blockingHandler{release: make(chan struct{})}, closed: make(chan struct{})}
+	h := logged.AsyncHandler(bh, 10, logged.OverflowBlock)
+
+	h.Log("1", logged.Info, []interface{}{})
+	h.Log("2", logged.Info, []interface{}{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Error(t, h.(logged.Shutdowner).Shutdown(ctx))
+
+	close(bh.release)
+	select {
+	case <-bh.closed:
+	case <-time.After(time.Second):
+		t.Fatal("wrapped handler was not closed")
+	}
+
+	assert.NoError(t, h.(io.Closer).Close())
+}
+
+func TestAsyncHandler_InvalidQueueSize(t *testing.T) {
+	assert.Panics(t, func() {
+		logged.AsyncHandler(logged.DiscardHandler(), 0, logged.OverflowDropOldest)
+	})
+}
+
+func TestAsyncHandler_DoesntWriteAfterClose(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.AsyncHandler(rec, 10, logged.OverflowBlock)
+	h.(io.Closer).Close()
+
+	h.Log("test", logged.Info, []interface{}{})
+
+	assert.Len(t, rec.Lines(), 0)
+}
+
+func TestAsyncHandler_FlushAfterClose(t *testing.T) {
+	h := logged.AsyncHandler(logged.DiscardHandler(), 10, logged.OverflowBlock, logged.AsyncDrainTimeout(time.Second))
+	assert.NoError(t, h.(io.Closer).Close())
+
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		assert.NoError(t, h.(logged.Flusher).Flush())
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	}
+}
+
+func TestAsyncHandler_CallsUnderlyingClose(t *testing.T) {
+	testHandler := &CloseableHandler{}
+	h := logged.AsyncHandler(testHandler, 10, logged.OverflowBlock)
+
+	h.(io.Closer).Close()
+	h.(io.Closer).Close()
+
+	assert.True(t, testHandler.CloseCalled)
+}
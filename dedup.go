@@ -0,0 +1,268 @@
+package logged
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DedupOption represents an option for the dedup handler.
+type DedupOption func(*dedupHandler)
+
+// DedupMaxEntries sets the maximum number of distinct messages tracked. When
+// reached, the oldest message is forgotten, writing its summary.
+func DedupMaxEntries(n int) DedupOption {
+	return func(h *dedupHandler) {
+		h.maxEntries = n
+	}
+}
+
+type dedupEntry struct {
+	key     string
+	msg     string
+	lvl     Level
+	ctx     []interface{}
+	count   uint64
+	expires time.Time
+}
+
+type dedupHandler struct {
+	h          Handler
+	window     time.Duration
+	maxEntries int
+
+	mx      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// DedupHandler returns a handler that collapses repeated messages. The first
+// occurrence of a message, with the same level and context, is written
+// immediately and repeats within the window are counted. When the window ends,
+// the message is written again with the number of repeats in the "repeated" key.
+//
+// DedupHandler panics if the window or the maximum number of entries is
+// not positive.
+func DedupHandler(window time.Duration, h Handler, opts ...DedupOption) Handler {
+	dh := &dedupHandler{
+		h:          h,
+		window:     window,
+		maxEntries: 1000,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		done:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(dh)
+	}
+
+	if dh.window <= 0 {
+		panic(fmt.Sprintf("log: non-positive dedup window: %s", dh.window))
+	}
+	if dh.maxEntries < 1 {
+		panic(fmt.Sprintf("log: invalid dedup max entries: %d", dh.maxEntries))
+	}
+
+	dh.wg.Add(1)
+	go dh.run()
+
+	return dh
+}
+
+func (h *dedupHandler) run() {
+	defer h.wg.Done()
+
+	// Expired messages are also summarised as messages are logged, so
+	// short windows do not need to be checked more often
+	ticker := time.NewTicker(max(h.window/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.mx.Lock()
+			pending := h.expire(time.Now())
+			h.mx.Unlock()
+
+			h.summarise(pending)
+
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Log write the log message.
+func (h *dedupHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	key := dedupKey(msg, lvl, ctx)
+	now := time.Now()
+
+	h.mx.Lock()
+	pending := h.expire(now)
+
+	if elem, ok := h.entries[key]; ok {
+		elem.Value.(*dedupEntry).count++
+		h.mx.Unlock()
+
+		h.summarise(pending)
+		return
+	}
+
+	if h.order.Len() >= h.maxEntries {
+		pending = append(pending, h.remove(h.order.Front()))
+	}
+
+	e := &dedupEntry{
+		key:     key,
+		msg:     msg,
+		lvl:     lvl,
+		ctx:     merge(ctx, nil),
+		expires: now.Add(h.window),
+	}
+	h.entries[key] = h.order.PushBack(e)
+	h.mx.Unlock()
+
+	h.summarise(pending)
+	h.h.Log(msg, lvl, ctx)
+}
+
+// expire removes the entries whose window has ended, returning them. It must
+// be called with the lock held.
+func (h *dedupHandler) expire(now time.Time) []*dedupEntry {
+	var pending []*dedupEntry
+	for elem := h.order.Front(); elem != nil; elem = h.order.Front() {
+		if elem.Value.(*dedupEntry).expires.After(now) {
+			break
+		}
+
+		pending = append(pending, h.remove(elem))
+	}
+
+	return pending
+}
+
+// remove removes an entry. It must be called with the lock held.
+func (h *dedupHandler) remove(elem *list.Element) *dedupEntry {
+	e := h.order.Remove(elem).(*dedupEntry)
+	delete(h.entries, e.key)
+
+	return e
+}
+
+// summarise writes the number of repeats of the entries that were repeated.
+func (h *dedupHandler) summarise(entries []*dedupEntry) {
+	for _, e := range entries {
+		if e.count == 0 {
+			continue
+		}
+
+		h.h.Log(e.msg, e.lvl, append(e.ctx, "repeated", e.count))
+	}
+}
+
+// Enabled returns true if the wrapped handler writes messages of the level.
+func (h *dedupHandler) Enabled(lvl Level) bool {
+	return enabled(h.h, lvl)
+}
+
+// Flush flushes the wrapped handler.
+func (h *dedupHandler) Flush() error {
+	return tryFlush(h.h)
+}
+
+// Close writes all pending summaries and closes the wrapped handler.
+func (h *dedupHandler) Close() error {
+	return h.Shutdown(context.Background())
+}
+
+// Shutdown writes all pending summaries and shuts down the wrapped handler.
+func (h *dedupHandler) Shutdown(ctx context.Context) error {
+	h.once.Do(func() {
+		close(h.done)
+		h.wg.Wait()
+
+		h.mx.Lock()
+		var pending []*dedupEntry
+		for elem := h.order.Front(); elem != nil; elem = h.order.Front() {
+			pending = append(pending, h.remove(elem))
+		}
+		h.mx.Unlock()
+
+		h.summarise(pending)
+	})
+
+	return tryShutdown(ctx, h.h)
+}
+
+// dedupKey returns a key identifying the message, level and context. Values
+// are written with their type and in full, so only equal contexts share a key.
+func dedupKey(msg string, lvl Level, ctx []interface{}) string {
+	b := strconv.AppendInt(nil, int64(lvl), 10)
+	b = appendDedupString(b, 's', msg)
+
+	// Values are terminated, as numbers have no length prefix
+	for _, v := range ctx {
+		b = append(appendDedupValue(b, v), ';')
+	}
+
+	return string(b)
+}
+
+// appendDedupValue appends a type tag and the value.
+func appendDedupValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(b, 'n')
+	case string:
+		return appendDedupString(b, 's', v)
+	case bool:
+		return strconv.AppendBool(append(b, 'b'), v)
+	case int:
+		return strconv.AppendInt(append(b, 'i'), int64(v), 10)
+	case int8:
+		return strconv.AppendInt(append(b, 'i'), int64(v), 10)
+	case int16:
+		return strconv.AppendInt(append(b, 'i'), int64(v), 10)
+	case int32:
+		return strconv.AppendInt(append(b, 'i'), int64(v), 10)
+	case int64:
+		return strconv.AppendInt(append(b, 'i'), v, 10)
+	case uint:
+		return strconv.AppendUint(append(b, 'u'), uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(append(b, 'u'), uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(append(b, 'u'), uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(append(b, 'u'), uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(append(b, 'u'), v, 10)
+	case float32:
+		return strconv.AppendFloat(append(b, 'f'), float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(append(b, 'f'), v, 'g', -1, 64)
+	case time.Time:
+		return appendDedupString(b, 't', v.Format(time.RFC3339Nano))
+	case SecretValue:
+		return appendDedupString(b, 'x', fmt.Sprintf("%T:%+v", v.Reveal(), v.Reveal()))
+	case error:
+		return appendDedupString(b, 'e', errorMessage(v))
+	default:
+		return appendDedupString(b, 'v', fmt.Sprintf("%T:%+v", v, v))
+	}
+}
+
+// appendDedupString appends a type tag and the length prefixed string.
+func appendDedupString(b []byte, tag byte, s string) []byte {
+	b = strconv.AppendInt(append(b, tag), int64(len(s)), 10)
+	b = append(b, ':')
+	return append(b, s...)
+}
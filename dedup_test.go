@@ -0,0 +1,120 @@
+package logged_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupHandler(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.DedupHandler(time.Minute, rec)
+
+	h.Log("test", logged.Error, []interface{}{"a", 1})
+	h.Log("test", logged.Error, []interface{}{"a", 1})
+	h.Log("test", logged.Error, []interface{}{"a", 1})
+	h.Log("test", logged.Error, []interface{}{"a", 2})
+	h.Log("test", logged.Warn, []interface{}{"a", 1})
+	h.Log("other", logged.Error, []interface{}{"a", 1})
+
+	assert.Len(t, rec.Lines(), 4)
+
+	h.(io.Closer).Close()
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 5)
+	assert.Equal(t, LogLine{Msg: "test", Lvl: logged.Error, Ctx: []interface{}{"a", 1, "repeated", uint64(2)}}, lines[4])
+}
+
+func TestDedupHandler_DistinguishesValues(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.DedupHandler(time.Minute, rec)
+	defer h.(io.Closer).Close()
+
+	h.Log("test", logged.Error, []interface{}{"latency", 0.0011})
+	h.Log("test", logged.Error, []interface{}{"latency", 0.0014})
+	h.Log("test", logged.Error, []interface{}{"v", nil})
+	h.Log("test", logged.Error, []interface{}{"v", ""})
+	h.Log("test", logged.Error, []interface{}{"v", 1})
+	h.Log("test", logged.Error, []interface{}{"v", "1"})
+	h.Log("test", logged.Error, []interface{}{"v", uint(1)})
+
+	assert.Len(t, rec.Lines(), 7)
+}
+
+func TestDedupHandler_SummarisesAfterWindow(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.DedupHandler(10*time.Millisecond, rec)
+	defer h.(io.Closer).Close()
+
+	h.Log("test", logged.Error, []interface{}{})
+	h.Log("test", logged.Error, []interface{}{})
+
+	time.Sleep(30 * time.Millisecond)
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 2)
+	assert.Equal(t, []interface{}{"repeated", uint64(1)}, lines[1].Ctx)
+
+	h.Log("test", logged.Error, []interface{}{})
+
+	assert.Len(t, rec.Lines(), 3)
+}
+
+func TestDedupHandler_MaxEntries(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.DedupHandler(time.Minute, rec, logged.DedupMaxEntries(1))
+	defer h.(io.Closer).Close()
+
+	h.Log("a", logged.Error, []interface{}{})
+	h.Log("a", logged.Error, []interface{}{})
+	h.Log("b", logged.Error, []interface{}{})
+
+	want := []LogLine{
+		{Msg: "a", Lvl: logged.Error, Ctx: []interface{}{}},
+		{Msg: "a", Lvl: logged.Error, Ctx: []interface{}{"repeated", uint64(1)}},
+		{Msg: "b", Lvl: logged.Error, Ctx: []interface{}{}},
+	}
+	assert.Equal(t, want, rec.Lines())
+}
+
+func TestDedupHandler_CallsUnderlyingClose(t *testing.T) {
+	testHandler := &CloseableHandler{}
+	h := logged.DedupHandler(time.Minute, testHandler)
+
+	h.(io.Closer).Close()
+	h.(io.Closer).Close()
+
+	assert.True(t, testHandler.CloseCalled)
+}
+
+func TestDedupHandler_CallsUnderlyingFlush(t *testing.T) {
+	testHandler := &FlushableHandler{}
+	h := logged.DedupHandler(time.Minute, testHandler)
+	defer h.(io.Closer).Close()
+
+	h.(logged.Flusher).Flush()
+
+	assert.True(t, testHandler.FlushCalled)
+}
+
+func TestDedupHandler_InvalidWindow(t *testing.T) {
+	assert.Panics(t, func() {
+		logged.DedupHandler(0, logged.DiscardHandler())
+	})
+
+	h := logged.DedupHandler(time.Nanosecond, logged.DiscardHandler())
+	assert.NoError(t, h.(io.Closer).Close())
+}
+
+func TestDedupHandler_InvalidMaxEntries(t *testing.T) {
+	assert.Panics(t, func() {
+		logged.DedupHandler(time.Second, logged.DiscardHandler(), logged.DedupMaxEntries(0))
+	})
+	assert.Panics(t, func() {
+		logged.DedupHandler(time.Second, logged.DiscardHandler(), logged.DedupMaxEntries(-1))
+	})
+}
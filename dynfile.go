@@ -0,0 +1,386 @@
+package logged
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DynamicFileStats contains the statistics of a dynamic file handler.
+type DynamicFileStats struct {
+	// Open is the number of open files.
+	Open int
+}
+
+// DynamicFileOption represents an option for the dynamic file handler.
+type DynamicFileOption func(*dynamicFileHandler)
+
+// DynamicFileMaxOpen sets the maximum number of open files. When reached,
+// the least recently used file is closed. The default is 100.
+func DynamicFileMaxOpen(n int) DynamicFileOption {
+	return func(h *dynamicFileHandler) {
+		h.maxOpen = n
+	}
+}
+
+// DynamicFileIdleTimeout sets the time after which a file that has not
+// been written to is closed. The default is 5 minutes. A zero duration
+// keeps files open until they are evicted.
+func DynamicFileIdleTimeout(d time.Duration) DynamicFileOption {
+	return func(h *dynamicFileHandler) {
+		h.idle = d
+	}
+}
+
+// DynamicFileFallback sets the handler messages are written to when their
+// context is missing a key of the path template. By default they are discarded.
+func DynamicFileFallback(fallback Handler) DynamicFileOption {
+	return func(h *dynamicFileHandler) {
+		h.fallback = fallback
+	}
+}
+
+// DynamicFilePerm sets the permissions of created files. The default is 0644.
+func DynamicFilePerm(perm os.FileMode) DynamicFileOption {
+	return func(h *dynamicFileHandler) {
+		h.perm = perm
+	}
+}
+
+type pathPart struct {
+	lit string
+	key string
+}
+
+type dynamicFile struct {
+	path     string
+	f        *os.File
+	h        Handler
+	lastUsed time.Time
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// close closes the file, waiting for writes in progress to finish.
+func (f *dynamicFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	return f.f.Close()
+}
+
+type dynamicFileHandler struct {
+	parts    []pathPart
+	root     string
+	fmtr     Formatter
+	maxOpen  int
+	idle     time.Duration
+	fallback Handler
+	perm     os.FileMode
+
+	mx     sync.Mutex
+	files  map[string]*list.Element
+	order  *list.List
+	closed bool
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// DynamicFileHandler returns a handler that writes log messages to a file
+// chosen by the message context with the given format. The path template
+// contains context keys in braces, such as "/var/log/jobs/{job_id}.log".
+// Context values are sanitised, replacing path separators and other unsafe
+// characters with "_", so a path can never leave the template directory.
+func DynamicFileHandler(template string, fmtr Formatter, opts ...DynamicFileOption) (Handler, error) {
+	parts, err := parsePathTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &dynamicFileHandler{
+		parts:    parts,
+		root:     filepath.Clean(filepath.Dir(parts[0].lit + "x")),
+		fmtr:     fmtr,
+		maxOpen:  100,
+		idle:     5 * time.Minute,
+		fallback: DiscardHandler(),
+		perm:     0644,
+		files:    map[string]*list.Element{},
+		order:    list.New(),
+		done:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.idle < 0 {
+		return nil, fmt.Errorf("log: invalid dynamic file idle timeout: %s", h.idle)
+	}
+
+	if h.idle > 0 {
+		h.wg.Add(1)
+		go h.run()
+	}
+
+	return h, nil
+}
+
+// parsePathTemplate splits a path template into literals and keys. The
+// first part is always a literal, possibly empty.
+func parsePathTemplate(template string) ([]pathPart, error) {
+	parts := []pathPart{{}}
+	for s := template; s != ""; {
+		i := strings.IndexAny(s, "{}")
+		if i < 0 {
+			parts = append(parts, pathPart{lit: s})
+			break
+		}
+		if s[i] == '}' {
+			return nil, fmt.Errorf("log: invalid path template %q: unexpected \"}\"", template)
+		}
+
+		if i > 0 {
+			parts = append(parts, pathPart{lit: s[:i]})
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("log: invalid path template %q: unterminated \"{\"", template)
+		}
+
+		key := s[i+1 : i+end]
+		if key == "" || strings.ContainsRune(key, '{') {
+			return nil, fmt.Errorf("log: invalid path template %q: invalid key %q", template, key)
+		}
+		parts = append(parts, pathPart{key: key})
+
+		s = s[i+end+1:]
+	}
+
+	// Merge the leading literal so the root directory can be found
+	if len(parts) > 1 && parts[1].key == "" {
+		parts[0].lit = parts[1].lit
+		parts = append(parts[:1], parts[2:]...)
+	}
+
+	return parts, nil
+}
+
+// path returns the file path for the context, or false if a key is missing.
+func (h *dynamicFileHandler) path(ctx []interface{}) (string, bool) {
+	var sb strings.Builder
+	for _, p := range h.parts {
+		if p.key == "" {
+			sb.WriteString(p.lit)
+			continue
+		}
+
+		v, ok := lookupKey(ctx, p.key)
+		if !ok {
+			return "", false
+		}
+		sb.WriteString(sanitizePathValue(stringValue(v)))
+	}
+
+	path := filepath.Clean(sb.String())
+
+	// Values cannot contain separators, this guards against the template
+	rel, err := filepath.Rel(h.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return path, true
+}
+
+// sanitizePathValue replaces the characters of a value that are not safe in
+// a file name with "_".
+func sanitizePathValue(v string) string {
+	if v == "" || strings.Trim(v, ".") == "" {
+		// Empty values and dot segments would change the directory
+		return strings.Repeat("_", len(v)+1)
+	}
+
+	b := []byte(v)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_':
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+func (h *dynamicFileHandler) run() {
+	defer h.wg.Done()
+
+	// Files are checked at least every millisecond, as a ticker needs a
+	// positive period
+	ticker := time.NewTicker(max(h.idle/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cutoff := time.Now().Add(-h.idle)
+
+			var idle []*dynamicFile
+			h.mx.Lock()
+			for elem := h.order.Back(); elem != nil; elem = h.order.Back() {
+				if elem.Value.(*dynamicFile).lastUsed.After(cutoff) {
+					break
+				}
+				idle = append(idle, h.remove(elem))
+			}
+			h.mx.Unlock()
+
+			if err := h.closeFiles(idle); err != nil {
+				reportError(err)
+			}
+
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Log write the log message.
+func (h *dynamicFileHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	path, ok := h.path(ctx)
+	if !ok {
+		h.fallback.Log(msg, lvl, ctx)
+		return
+	}
+
+	for {
+		f, evicted, err := h.file(path)
+		if cerr := h.closeFiles(evicted); cerr != nil {
+			reportError(cerr)
+		}
+		if err != nil {
+			reportError(err)
+			return
+		}
+		if f == nil {
+			return
+		}
+
+		f.mu.RLock()
+		if f.closed {
+			// The file was evicted before it could be written, try again
+			f.mu.RUnlock()
+			continue
+		}
+		f.h.Log(msg, lvl, ctx)
+		f.mu.RUnlock()
+
+		return
+	}
+}
+
+// file returns the open file for the path, opening it if needed, and the
+// files evicted to make room for it. A nil file is returned once the
+// handler is closed.
+func (h *dynamicFileHandler) file(path string) (*dynamicFile, []*dynamicFile, error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.closed {
+		return nil, nil, nil
+	}
+
+	if elem, ok := h.files[path]; ok {
+		f := elem.Value.(*dynamicFile)
+		f.lastUsed = time.Now()
+		h.order.MoveToFront(elem)
+
+		return f, nil, nil
+	}
+
+	var evicted []*dynamicFile
+	for h.maxOpen > 0 && h.order.Len() >= h.maxOpen {
+		evicted = append(evicted, h.remove(h.order.Back()))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, evicted, fmt.Errorf("log: could not create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, h.perm)
+	if err != nil {
+		return nil, evicted, fmt.Errorf("log: could not open log file: %w", err)
+	}
+
+	f := &dynamicFile{
+		path:     path,
+		f:        file,
+		h:        StreamHandler(file, h.fmtr),
+		lastUsed: time.Now(),
+	}
+	h.files[path] = h.order.PushFront(f)
+
+	return f, evicted, nil
+}
+
+// remove removes a file from the cache. It must be called with the lock held.
+func (h *dynamicFileHandler) remove(elem *list.Element) *dynamicFile {
+	f := h.order.Remove(elem).(*dynamicFile)
+	delete(h.files, f.path)
+
+	return f
+}
+
+func (h *dynamicFileHandler) closeFiles(files []*dynamicFile) error {
+	var errs []error
+	for _, f := range files {
+		if err := f.close(); err != nil {
+			errs = append(errs, fmt.Errorf("log: could not close log file: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stats returns the statistics of the handler.
+func (h *dynamicFileHandler) Stats() DynamicFileStats {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return DynamicFileStats{Open: h.order.Len()}
+}
+
+// Close closes all open files and the fallback handler.
+func (h *dynamicFileHandler) Close() error {
+	h.once.Do(func() {
+		close(h.done)
+	})
+	h.wg.Wait()
+
+	h.mx.Lock()
+	if h.closed {
+		h.mx.Unlock()
+		return nil
+	}
+	h.closed = true
+
+	var files []*dynamicFile
+	for elem := h.order.Front(); elem != nil; elem = h.order.Front() {
+		files = append(files, h.remove(elem))
+	}
+	h.mx.Unlock()
+
+	return errors.Join(h.closeFiles(files), tryClose(h.fallback))
+}
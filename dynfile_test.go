@@ -0,0 +1,183 @@
+package logged_test
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type dynamicFileStatser interface {
+	Stats() logged.DynamicFileStats
+}
+
+func TestDynamicFileHandler(t *testing.T) {
+	dir := t.TempDir()
+	h, err := logged.DynamicFileHandler(filepath.Join(dir, "jobs", "{job_id}.log"), logged.LogfmtFormat())
+	assert.NoError(t, err)
+
+	h.Log("one", logged.Info, []interface{}{"job_id", "a"})
+	h.Log("two", logged.Info, []interface{}{"job_id", 42})
+	h.Log("three", logged.Info, []interface{}{"job_id", "a"})
+	assert.NoError(t, h.(io.Closer).Close())
+
+	assert.Equal(t, []string{"42.log", "a.log"}, dirFiles(t, filepath.Join(dir, "jobs")))
+	assert.Equal(t, "lvl=info msg=one job_id=a\nlvl=info msg=three job_id=a\n", readFile(t, filepath.Join(dir, "jobs", "a.log")))
+	assert.Equal(t, "lvl=info msg=two job_id=42\n", readFile(t, filepath.Join(dir, "jobs", "42.log")))
+}
+
+func TestDynamicFileHandler_MultipleKeys(t *testing.T) {
+	dir := t.TempDir()
+	h, err := logged.DynamicFileHandler(filepath.Join(dir, "{tenant}", "job-{job_id}.log"), logged.LogfmtFormat())
+	assert.NoError(t, err)
+
+	h.Log("one", logged.Info, []interface{}{"job_id", 1, "tenant", "acme"})
+	assert.NoError(t, h.(io.Closer).Close())
+
+	assert.Equal(t, "lvl=info msg=one job_id=1 tenant=acme\n", readFile(t, filepath.Join(dir, "acme", "job-1.log")))
+}
+
+func TestDynamicFileHandler_SanitizesValues(t *testing.T) {
+	tests := []struct {
+		value string
+		file  string
+	}{
+		{"../../etc/passwd", ".._.._etc_passwd.log"},
+		{"..", "___.log"},
+		{"", "_.log"},
+		{`a\b c:d`, "a_b_c_d.log"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			dir := t.TempDir()
+			h, err := logged.DynamicFileHandler(filepath.Join(dir, "jobs", "{job_id}.log"), logged.LogfmtFormat())
+			assert.NoError(t, err)
+
+			h.Log("one", logged.Info, []interface{}{"job_id", tt.value})
+			assert.NoError(t, h.(io.Closer).Close())
+
+			assert.Equal(t, []string{"jobs"}, dirFiles(t, dir))
+			assert.Equal(t, []string{tt.file}, dirFiles(t, filepath.Join(dir, "jobs")))
+		})
+	}
+}
+
+func TestDynamicFileHandler_MissingKeyUsesFallback(t *testing.T) {
+	dir := t.TempDir()
+	fallback := &RecordingHandler{}
+	h, err := logged.DynamicFileHandler(filepath.Join(dir, "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileFallback(fallback))
+	assert.NoError(t, err)
+
+	h.Log("one", logged.Info, []interface{}{"foo", "bar"})
+	assert.NoError(t, h.(io.Closer).Close())
+
+	assert.Empty(t, dirFiles(t, dir))
+	assert.Equal(t, []string{"one"}, msgs(fallback.Lines()))
+}
+
+func TestDynamicFileHandler_MaxOpen(t *testing.T) {
+	dir := t.TempDir()
+	h, err := logged.DynamicFileHandler(filepath.Join(dir, "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileMaxOpen(2))
+	assert.NoError(t, err)
+
+	h.Log("one", logged.Info, []interface{}{"job_id", "a"})
+	h.Log("two", logged.Info, []interface{}{"job_id", "b"})
+	assert.Equal(t, 2, h.(dynamicFileStatser).Stats().Open)
+	h.Log("three", logged.Info, []interface{}{"job_id", "c"})
+	assert.Equal(t, 2, h.(dynamicFileStatser).Stats().Open)
+	h.Log("four", logged.Info, []interface{}{"job_id", "a"})
+	assert.NoError(t, h.(io.Closer).Close())
+
+	assert.Equal(t, "lvl=info msg=one job_id=a\nlvl=info msg=four job_id=a\n", readFile(t, filepath.Join(dir, "a.log")))
+}
+
+func TestDynamicFileHandler_ClosesIdleFiles(t *testing.T) {
+	h, err := logged.DynamicFileHandler(filepath.Join(t.TempDir(), "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileIdleTimeout(10*time.Millisecond))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("one", logged.Info, []interface{}{"job_id", "a"})
+	assert.Equal(t, 1, h.(dynamicFileStatser).Stats().Open)
+
+	assert.Eventually(t, func() bool {
+		return h.(dynamicFileStatser).Stats().Open == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestDynamicFileHandler_Close(t *testing.T) {
+	dir := t.TempDir()
+	fallback := &CloseableHandler{}
+	h, err := logged.DynamicFileHandler(filepath.Join(dir, "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileFallback(fallback))
+	assert.NoError(t, err)
+
+	h.Log("one", logged.Info, []interface{}{"job_id", "a"})
+	h.Log("two", logged.Info, []interface{}{"job_id", "b"})
+	assert.NoError(t, h.(io.Closer).Close())
+	h.Log("three", logged.Info, []interface{}{"job_id", "a"})
+
+	assert.Equal(t, 0, h.(dynamicFileStatser).Stats().Open)
+	assert.True(t, fallback.CloseCalled)
+	assert.Equal(t, "lvl=info msg=one job_id=a\n", readFile(t, filepath.Join(dir, "a.log")))
+}
+
+func TestDynamicFileHandler_ConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	h, err := logged.DynamicFileHandler(filepath.Join(dir, "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileMaxOpen(1))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Log("some message", logged.Info, []interface{}{"job_id", j % 3, "writer", i})
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.NoError(t, h.(io.Closer).Close())
+
+	var count int
+	for i := 0; i < 3; i++ {
+		content := readFile(t, filepath.Join(dir, fmt.Sprintf("%d.log", i)))
+		for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+			count++
+			assert.Equal(t, fmt.Sprintf("lvl=info msg=\"some message\" job_id=%d writer=", i), line[:len(line)-1])
+		}
+	}
+	assert.Equal(t, 400, count)
+}
+
+func TestDynamicFileHandler_InvalidTemplate(t *testing.T) {
+	tests := []string{
+		"/var/log/{job_id.log",
+		"/var/log/job_id}.log",
+		"/var/log/{}.log",
+		"/var/log/{{job_id}}.log",
+	}
+
+	for _, tmpl := range tests {
+		t.Run(tmpl, func(t *testing.T) {
+			_, err := logged.DynamicFileHandler(tmpl, logged.LogfmtFormat())
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDynamicFileHandler_IdleTimeout(t *testing.T) {
+	_, err := logged.DynamicFileHandler(filepath.Join(t.TempDir(), "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileIdleTimeout(-time.Second))
+	assert.Error(t, err)
+
+	h, err := logged.DynamicFileHandler(filepath.Join(t.TempDir(), "{job_id}.log"), logged.LogfmtFormat(), logged.DynamicFileIdleTimeout(time.Nanosecond))
+	assert.NoError(t, err)
+	assert.NoError(t, h.(io.Closer).Close())
+}
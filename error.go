@@ -0,0 +1,156 @@
+package logged
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// CausesSuffix is appended to the key of an error value to hold its cause chain.
+const CausesSuffix = ".causes"
+
+// fieldError is an error carrying key/value context.
+type fieldError struct {
+	err error
+	ctx []interface{}
+}
+
+// WrapError attaches the key/value pairs in ctx to the error. When the
+// returned error, or any error wrapping it, is logged the pairs are merged
+// into the log line.
+func WrapError(err error, ctx ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	return &fieldError{
+		err: err,
+		ctx: normalize(ctx),
+	}
+}
+
+// Errorf formats an error as fmt.Errorf does, including wrapping errors with
+// %w, and attaches the key/value pairs in ctx to it as WrapError does.
+func Errorf(ctx []interface{}, format string, args ...interface{}) error {
+	return WrapError(fmt.Errorf(format, args...), ctx...)
+}
+
+// Error returns the message of the wrapped error.
+func (e *fieldError) Error() string {
+	return errorMessage(e.err)
+}
+
+// Unwrap returns the wrapped error.
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// ErrorFields returns the key/value pairs attached to the error and
+// every error in its chain, outermost first.
+func ErrorFields(err error) []interface{} {
+	var ctx []interface{}
+	walkErrors(err, func(err error) {
+		if fe, ok := err.(*fieldError); ok {
+			ctx = append(ctx, fe.ctx...)
+		}
+	})
+
+	return ctx
+}
+
+// walkErrors calls fn for the error and every error in its tree, depth first.
+func walkErrors(err error, fn func(error)) {
+	if isNilError(err) {
+		return
+	}
+
+	fn(err)
+
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			walkErrors(err, fn)
+		}
+	case interface{ Unwrap() error }:
+		walkErrors(e.Unwrap(), fn)
+	}
+}
+
+// errorCauses returns the messages of the errors wrapped by err, depth first.
+// Field errors are transparent and are not reported as causes.
+func errorCauses(err error) []string {
+	var causes []string
+	var walk func(err error)
+	walk = func(err error) {
+		if isNilError(err) {
+			return
+		}
+
+		var children []error
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			children = e.Unwrap()
+		case interface{ Unwrap() error }:
+			children = []error{e.Unwrap()}
+		}
+
+		for _, child := range children {
+			child = stripFields(child)
+			if child == nil {
+				continue
+			}
+
+			causes = append(causes, errorMessage(child))
+			walk(child)
+		}
+	}
+	walk(stripFields(err))
+
+	return causes
+}
+
+// stripFields unwraps any field errors at the top of the chain.
+func stripFields(err error) error {
+	for {
+		fe, ok := err.(*fieldError)
+		if !ok {
+			return err
+		}
+		err = fe.err
+	}
+}
+
+// isNilError reports whether the error is nil or a nil pointer, such as a
+// typed nil returned as an error, whose methods may not be called.
+func isNilError(err error) bool {
+	if err == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// errorMessage returns the message of the error, or "<nil>" for a nil
+// pointer as fmt does.
+func errorMessage(err error) string {
+	if isNilError(err) {
+		return "<nil>"
+	}
+
+	return err.Error()
+}
+
+// withErrorFields appends the fields of any errors in ctx to ctx.
+func withErrorFields(ctx []interface{}) []interface{} {
+	n := len(ctx)
+	for i := 1; i < n; i += 2 {
+		err, ok := ctx[i].(error)
+		if !ok {
+			continue
+		}
+
+		ctx = append(ctx, ErrorFields(err)...)
+	}
+
+	return ctx
+}
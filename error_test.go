@@ -0,0 +1,59 @@
+package logged_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	base := errors.New("test error")
+
+	err := logged.WrapError(base, "a", 1)
+
+	assert.Equal(t, "test error", err.Error())
+	assert.True(t, errors.Is(err, base))
+}
+
+func TestWrapError_Nil(t *testing.T) {
+	err := logged.WrapError(nil, "a", 1)
+
+	assert.Nil(t, err)
+}
+
+func TestErrorf(t *testing.T) {
+	base := logged.WrapError(errors.New("test error"), "a", 1)
+
+	err := logged.Errorf([]interface{}{"b", 2}, "query %s: %w", "users", base)
+
+	assert.Equal(t, "query users: test error", err.Error())
+	assert.True(t, errors.Is(err, base))
+	assert.Equal(t, []interface{}{"b", 2, "a", 1}, logged.ErrorFields(err))
+}
+
+func TestErrorFields(t *testing.T) {
+	inner := logged.WrapError(errors.New("inner"), "a", 1)
+	outer := logged.WrapError(fmt.Errorf("outer: %w", inner), "b", 2)
+	joined := errors.Join(outer, logged.WrapError(errors.New("other"), "c", 3))
+
+	ctx := logged.ErrorFields(joined)
+
+	assert.Equal(t, []interface{}{"b", 2, "a", 1, "c", 3}, ctx)
+}
+
+func TestErrorFields_NormalizesCtx(t *testing.T) {
+	err := logged.WrapError(errors.New("test"), "a")
+
+	ctx := logged.ErrorFields(err)
+
+	assert.Len(t, ctx, 4)
+}
+
+func TestErrorFields_NoFields(t *testing.T) {
+	ctx := logged.ErrorFields(fmt.Errorf("outer: %w", errors.New("inner")))
+
+	assert.Nil(t, ctx)
+}
@@ -0,0 +1,133 @@
+package logged
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FailoverOption represents an option for the failover handler.
+type FailoverOption func(*failoverHandler)
+
+// FailoverProbeInterval sets how often the primary handler is retried
+// while failed over.
+func FailoverProbeInterval(d time.Duration) FailoverOption {
+	return func(h *failoverHandler) {
+		h.probe = d
+	}
+}
+
+// FailoverBacklog sets the maximum number of messages kept while all
+// handlers are failing.
+func FailoverBacklog(n int) FailoverOption {
+	return func(h *failoverHandler) {
+		h.maxBacklog = n
+	}
+}
+
+type failoverEntry struct {
+	msg string
+	lvl Level
+	ctx []interface{}
+}
+
+type failoverHandler struct {
+	*multiHandler
+
+	probe      time.Duration
+	maxBacklog int
+
+	mx       sync.Mutex
+	active   int
+	failedAt time.Time
+	backlog  []failoverEntry
+}
+
+// FailoverHandler returns a handler that writes messages to the primary
+// handler until it fails to write a message, then to the first of the
+// secondary handlers that succeeds. The failed message is written to the
+// secondary handler, so nothing is lost. The primary handler is retried
+// periodically, switching back once it succeeds. If all handlers fail,
+// messages are kept and written once a handler succeeds.
+//
+// Failures are detected from handlers implementing FallibleHandler, which
+// includes the filtering and redacting handlers wrapping one; other handlers
+// are assumed to always succeed. A NetHandler buffers messages while it is
+// disconnected, so it only fails when buffering is disabled with
+// NetBufferSize(0).
+func FailoverHandler(primary Handler, secondaries ...Handler) Handler {
+	return FailoverHandlerWithOptions(append([]Handler{primary}, secondaries...))
+}
+
+// FailoverHandlerWithOptions returns a failover handler using the first of
+// the handlers as the primary handler, with the given options.
+func FailoverHandlerWithOptions(hs []Handler, opts ...FailoverOption) Handler {
+	h := &failoverHandler{
+		multiHandler: &multiHandler{hs: hs},
+		probe:        30 * time.Second,
+		maxBacklog:   1000,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Log write the log message.
+func (h *failoverHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	now := time.Now()
+	if h.active > 0 && now.Sub(h.failedAt) >= h.probe {
+		h.failedAt = now
+		if h.write(0, msg, lvl, ctx) {
+			h.active = 0
+			return
+		}
+	}
+
+	for i := h.active; i < len(h.hs); i++ {
+		if h.write(i, msg, lvl, ctx) {
+			if i != h.active {
+				h.active = i
+				h.failedAt = now
+			}
+			return
+		}
+	}
+
+	h.keep(failoverEntry{msg: msg, lvl: lvl, ctx: merge(ctx, nil)})
+}
+
+// write writes the backlog and the message to the handler at index i,
+// returning false on the first failure. It must be called with the lock held.
+func (h *failoverHandler) write(i int, msg string, lvl Level, ctx []interface{}) bool {
+	for len(h.backlog) > 0 {
+		e := h.backlog[0]
+		if err := tryLog(h.hs[i], e.msg, e.lvl, e.ctx); err != nil {
+			return false
+		}
+		h.backlog = h.backlog[1:]
+	}
+
+	return tryLog(h.hs[i], msg, lvl, ctx) == nil
+}
+
+// keep adds a message to the backlog, dropping the oldest message when full.
+// It must be called with the lock held.
+func (h *failoverHandler) keep(e failoverEntry) {
+	if h.maxBacklog <= 0 {
+		reportError(fmt.Errorf("log: all handlers failing, dropped message: %s", e.msg))
+		return
+	}
+
+	if len(h.backlog) >= h.maxBacklog {
+		reportError(fmt.Errorf("log: all handlers failing, dropped message: %s", h.backlog[0].msg))
+		h.backlog = h.backlog[1:]
+	}
+
+	h.backlog = append(h.backlog, e)
+}
@@ -0,0 +1,137 @@
+package logged_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type fallibleHandler struct {
+	RecordingHandler
+
+	failing atomic.Bool
+}
+
+func (h *fallibleHandler) TryLog(msg string, lvl logged.Level, ctx []interface{}) error {
+	if h.failing.Load() {
+		return errors.New("test error")
+	}
+
+	h.Log(msg, lvl, ctx)
+	return nil
+}
+
+func msgs(lines []LogLine) []string {
+	var out []string
+	for _, l := range lines {
+		out = append(out, l.Msg)
+	}
+	return out
+}
+
+func TestFailoverHandler(t *testing.T) {
+	primary := &fallibleHandler{}
+	secondary := &fallibleHandler{}
+	h := logged.FailoverHandler(primary, secondary)
+
+	h.Log("1", logged.Info, []interface{}{})
+	primary.failing.Store(true)
+	h.Log("2", logged.Info, []interface{}{})
+	h.Log("3", logged.Info, []interface{}{})
+
+	assert.Equal(t, []string{"1"}, msgs(primary.Lines()))
+	assert.Equal(t, []string{"2", "3"}, msgs(secondary.Lines()))
+}
+
+func TestFailoverHandler_ProbesPrimary(t *testing.T) {
+	primary := &fallibleHandler{}
+	secondary := &fallibleHandler{}
+	h := logged.FailoverHandlerWithOptions([]logged.Handler{primary, secondary}, logged.FailoverProbeInterval(10*time.Millisecond))
+
+	primary.failing.Store(true)
+	h.Log("1", logged.Info, []interface{}{})
+	primary.failing.Store(false)
+	h.Log("2", logged.Info, []interface{}{})
+
+	time.Sleep(20 * time.Millisecond)
+
+	h.Log("3", logged.Info, []interface{}{})
+
+	assert.Equal(t, []string{"3"}, msgs(primary.Lines()))
+	assert.Equal(t, []string{"1", "2"}, msgs(secondary.Lines()))
+}
+
+func TestFailoverHandler_KeepsBacklog(t *testing.T) {
+	primary := &fallibleHandler{}
+	secondary := &fallibleHandler{}
+	h := logged.FailoverHandlerWithOptions([]logged.Handler{primary, secondary}, logged.FailoverBacklog(2))
+
+	primary.failing.Store(true)
+	secondary.failing.Store(true)
+	h.Log("1", logged.Info, []interface{}{})
+	h.Log("2", logged.Info, []interface{}{})
+	h.Log("3", logged.Info, []interface{}{})
+	secondary.failing.Store(false)
+	h.Log("4", logged.Info, []interface{}{})
+
+	assert.Len(t, primary.Lines(), 0)
+	assert.Equal(t, []string{"2", "3", "4"}, msgs(secondary.Lines()))
+}
+
+func TestFailoverHandler_StreamHandler(t *testing.T) {
+	fallback := &RecordingHandler{}
+	h := logged.FailoverHandler(
+		logged.StreamHandler(&failingWriter{}, logged.LogfmtFormat(), logged.StreamErrorHandler(func(error) {})),
+		fallback,
+	)
+
+	h.Log("1", logged.Info, []interface{}{})
+
+	assert.Len(t, fallback.Lines(), 1)
+}
+
+func TestFailoverHandler_WrappedPrimary(t *testing.T) {
+	fallback := &RecordingHandler{}
+	primary := logged.LevelFilterHandler(logged.Debug, logged.RedactHandler(
+		logged.StreamHandler(&failingWriter{}, logged.LogfmtFormat(), logged.StreamErrorHandler(func(error) {})),
+	))
+	h := logged.FailoverHandler(primary, fallback)
+
+	h.Log("1", logged.Info, []interface{}{"password", "secret"})
+
+	assert.Len(t, fallback.Lines(), 1)
+}
+
+func TestFailoverHandler_NetHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	primary, err := logged.NetHandler("tcp", addr, logged.LogfmtFormat(), logged.NetBufferSize(0), logged.NetErrorHandler(func(error) {}))
+	assert.NoError(t, err)
+	defer primary.(io.Closer).Close()
+	fallback := &RecordingHandler{}
+	h := logged.FailoverHandler(primary, fallback)
+
+	h.Log("1", logged.Info, []interface{}{})
+
+	assert.Equal(t, []string{"1"}, msgs(fallback.Lines()))
+}
+
+func TestFailoverHandler_CallsUnderlyingClose(t *testing.T) {
+	primary := &CloseableHandler{}
+	secondary := &CloseableHandler{}
+	h := logged.FailoverHandler(primary, secondary)
+
+	h.(io.Closer).Close()
+
+	assert.True(t, primary.CloseCalled)
+	assert.True(t, secondary.CloseCalled)
+}
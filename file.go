@@ -0,0 +1,468 @@
+package logged
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotationSchedule represents how often a file is rotated regardless of its size.
+type RotationSchedule int
+
+// List of rotation schedules.
+const (
+	RotateNever RotationSchedule = iota
+	RotateHourly
+	RotateDaily
+)
+
+// next returns the start of the period following t.
+func (s RotationSchedule) next(t time.Time) time.Time {
+	switch s {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// FileOption represents an option for a rotating file.
+type FileOption func(*RotatingFile)
+
+// FileMaxSize sets the size in bytes at which the file is rotated.
+func FileMaxSize(n int64) FileOption {
+	return func(f *RotatingFile) {
+		f.maxSize = n
+	}
+}
+
+// FileSchedule sets the schedule the file is rotated on. Rotations are
+// aligned to the wall clock, at the start of each hour or day.
+func FileSchedule(s RotationSchedule) FileOption {
+	return func(f *RotatingFile) {
+		f.schedule = s
+	}
+}
+
+// FileMaxBackups sets the maximum number of rotated files kept.
+func FileMaxBackups(n int) FileOption {
+	return func(f *RotatingFile) {
+		f.maxBackups = n
+	}
+}
+
+// FileMaxAge sets the maximum age of rotated files kept.
+func FileMaxAge(d time.Duration) FileOption {
+	return func(f *RotatingFile) {
+		f.maxAge = d
+	}
+}
+
+// FileCompress gzips rotated files in the background.
+func FileCompress() FileOption {
+	return func(f *RotatingFile) {
+		f.compress = true
+	}
+}
+
+// FileClock sets the function used to get the current time.
+func FileClock(fn func() time.Time) FileOption {
+	return func(f *RotatingFile) {
+		f.now = fn
+	}
+}
+
+// FilePerm sets the permissions of created files. The default is 0644.
+func FilePerm(perm os.FileMode) FileOption {
+	return func(f *RotatingFile) {
+		f.perm = perm
+	}
+}
+
+// RotatingFile is a file writer that rotates the file by size and on a
+// schedule. Rotated files are renamed with the time of rotation, such as
+// "app-2006-01-02T15-04-05.000.log" for "app.log".
+//
+// A rotation only ever happens between calls to Write, so a single write is
+// never split between two files. Writers that write whole lines, such as
+// StreamHandler and BufferedStreamHandler, never have a line split.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	schedule   RotationSchedule
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	now        func() time.Time
+	perm       os.FileMode
+
+	mu         sync.Mutex
+	f          *os.File
+	size       int64
+	next       time.Time
+	lastBackup time.Time
+	closed     bool
+
+	mill     chan struct{}
+	millDone chan struct{}
+}
+
+// NewRotatingFile opens a rotating file at path, appending to it if it exists.
+func NewRotatingFile(path string, opts ...FileOption) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:     path,
+		now:      time.Now,
+		perm:     0644,
+		mill:     make(chan struct{}, 1),
+		millDone: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("log: could not create log directory: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	go f.runMill()
+
+	// Backups left by a previous process are cleaned up straight away
+	f.signalMill()
+
+	return f, nil
+}
+
+// open opens the file. It must be called with the lock held.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, f.perm)
+	if err != nil {
+		return fmt.Errorf("log: could not open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("log: could not open log file: %w", err)
+	}
+
+	now := f.now()
+	since := now
+	if info.Size() > 0 {
+		// The schedule of an existing file starts from its last write
+		since = info.ModTime().In(now.Location())
+	}
+
+	f.f = file
+	f.size = info.Size()
+	f.next = f.schedule.next(since)
+
+	return nil
+}
+
+// Write writes p to the file, rotating it first if the write would exceed
+// the maximum size or the scheduled rotation time has passed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, fmt.Errorf("log: write to closed file: %w", os.ErrClosed)
+	}
+
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// shouldRotate returns true if the file should be rotated before writing
+// n bytes. It must be called with the lock held.
+func (f *RotatingFile) shouldRotate(n int) bool {
+	if !f.next.IsZero() && !f.now().Before(f.next) {
+		if f.size > 0 {
+			return true
+		}
+
+		// There is nothing to rotate, the schedule just moves on
+		f.next = f.schedule.next(f.now())
+	}
+
+	return f.maxSize > 0 && f.size > 0 && f.size+int64(n) > f.maxSize
+}
+
+// Rotate rotates the file, unless it is empty.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("log: rotate closed file: %w", os.ErrClosed)
+	}
+
+	if f.size == 0 {
+		return nil
+	}
+
+	return f.rotate()
+}
+
+// rotate renames the file to a backup and opens a new file. It must be
+// called with the lock held.
+func (f *RotatingFile) rotate() error {
+	if err := f.f.Close(); err != nil {
+		reportError(fmt.Errorf("log: could not close log file: %w", err))
+	}
+
+	var renameErr error
+	if err := os.Rename(f.path, f.backupName(f.now())); err != nil {
+		renameErr = fmt.Errorf("log: could not rotate log file: %w", err)
+	}
+
+	// The file is reopened even when the rename fails, so writes continue
+	if err := f.open(); err != nil {
+		// The file is closed from here on, so the mill is stopped as Close would
+		f.closed = true
+		close(f.mill)
+		return errors.Join(renameErr, err)
+	}
+
+	f.signalMill()
+
+	return renameErr
+}
+
+// backupName returns an unused backup name for a rotation at t. It must be
+// called with the lock held.
+func (f *RotatingFile) backupName(t time.Time) string {
+	prefix, ext := f.backupPattern()
+
+	t = t.Truncate(time.Millisecond)
+	for {
+		if !t.After(f.lastBackup) {
+			t = f.lastBackup.Add(time.Millisecond)
+		}
+		f.lastBackup = t
+
+		name := prefix + t.Format(backupTimeFormat) + ext
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+	}
+}
+
+// backupPattern returns the path prefix and extension of the backups.
+func (f *RotatingFile) backupPattern() (string, string) {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-", ext
+}
+
+func (f *RotatingFile) signalMill() {
+	select {
+	case f.mill <- struct{}{}:
+	default:
+	}
+}
+
+// runMill removes old backups and compresses new backups in the background.
+func (f *RotatingFile) runMill() {
+	defer close(f.millDone)
+
+	for range f.mill {
+		if err := f.millBackups(); err != nil {
+			reportError(err)
+		}
+	}
+}
+
+type backupFile struct {
+	path       string
+	time       time.Time
+	compressed bool
+}
+
+func (f *RotatingFile) millBackups() error {
+	if f.maxBackups <= 0 && f.maxAge <= 0 && !f.compress {
+		return nil
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	cutoff := f.now().Add(-f.maxAge)
+	for i, b := range backups {
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && b.time.Before(cutoff)) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("log: could not remove log file: %w", err))
+			}
+			continue
+		}
+
+		if f.compress && !b.compressed {
+			if err := compressFile(b.path, f.perm); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// backups returns the backups of the file, newest first.
+func (f *RotatingFile) backups() ([]backupFile, error) {
+	prefix, ext := f.backupPattern()
+	dir := filepath.Dir(f.path)
+	base := filepath.Base(prefix)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("log: could not read log directory: %w", err)
+	}
+
+	loc := f.now().Location()
+
+	var backups []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, base) {
+			continue
+		}
+
+		b := backupFile{path: filepath.Join(dir, name)}
+		ts := strings.TrimPrefix(name, base)
+		if strings.HasSuffix(ts, ext+".gz") {
+			ts = strings.TrimSuffix(ts, ext+".gz")
+			b.compressed = true
+		} else if strings.HasSuffix(ts, ext) {
+			ts = strings.TrimSuffix(ts, ext)
+		} else {
+			continue
+		}
+
+		t, err := time.ParseInLocation(backupTimeFormat, ts, loc)
+		if err != nil {
+			continue
+		}
+		b.time = t
+
+		backups = append(backups, b)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+
+	return backups, nil
+}
+
+// Close closes the file, waiting for background compression and clean up
+// to finish.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		<-f.millDone
+		return nil
+	}
+
+	f.closed = true
+	err := f.f.Close()
+	close(f.mill)
+	f.mu.Unlock()
+
+	<-f.millDone
+
+	return err
+}
+
+// compressFile gzips the file at path, removing the original.
+func compressFile(path string, perm os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("log: could not compress log file: %w", err)
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("log: could not compress log file: %w", err)
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("log: could not compress log file: %w", err)
+	}
+
+	src.Close()
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("log: could not remove log file: %w", err)
+	}
+
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type fileHandler struct {
+	*streamHandler
+
+	f *RotatingFile
+}
+
+// FileHandler returns a handler that writes log messages to a rotating
+// file with the given format.
+func FileHandler(path string, fmtr Formatter, opts ...FileOption) (Handler, error) {
+	f, err := NewRotatingFile(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileHandler{
+		streamHandler: StreamHandler(f, fmtr).(*streamHandler),
+		f:             f,
+	}, nil
+}
+
+// Close closes the file.
+func (h *fileHandler) Close() error {
+	return h.f.Close()
+}
@@ -0,0 +1,305 @@
+package logged_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(t time.Time) *fakeClock {
+	return &fakeClock{now: t}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func dirFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	return string(b)
+}
+
+func TestRotatingFile_RotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileMaxSize(10), logged.FileClock(clock.Now))
+	assert.NoError(t, err)
+
+	f.Write([]byte("first\n"))
+	clock.Add(time.Second)
+	f.Write([]byte("second\n"))
+	f.Write([]byte("a line longer than the max\n"))
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{
+		"app-2020-01-02T10-30-01.000.log",
+		"app-2020-01-02T10-30-01.001.log",
+		"app.log",
+	}, dirFiles(t, dir))
+	assert.Equal(t, "first\n", readFile(t, filepath.Join(dir, "app-2020-01-02T10-30-01.000.log")))
+	assert.Equal(t, "second\n", readFile(t, filepath.Join(dir, "app-2020-01-02T10-30-01.001.log")))
+	assert.Equal(t, "a line longer than the max\n", readFile(t, filepath.Join(dir, "app.log")))
+}
+
+func TestRotatingFile_RotatesOnSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule logged.RotationSchedule
+		same     time.Time
+		next     time.Time
+		backup   string
+	}{
+		{
+			name:     "Hourly",
+			schedule: logged.RotateHourly,
+			same:     time.Date(2020, 1, 2, 10, 59, 59, 0, time.UTC),
+			next:     time.Date(2020, 1, 2, 11, 0, 0, 0, time.UTC),
+			backup:   "app-2020-01-02T11-00-00.000.log",
+		},
+		{
+			name:     "Daily",
+			schedule: logged.RotateDaily,
+			same:     time.Date(2020, 1, 2, 23, 59, 59, 0, time.UTC),
+			next:     time.Date(2020, 1, 3, 0, 0, 1, 0, time.UTC),
+			backup:   "app-2020-01-03T00-00-01.000.log",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+			f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileSchedule(tt.schedule), logged.FileClock(clock.Now))
+			assert.NoError(t, err)
+
+			f.Write([]byte("first\n"))
+			clock.Set(tt.same)
+			f.Write([]byte("second\n"))
+			clock.Set(tt.next)
+			f.Write([]byte("third\n"))
+			assert.NoError(t, f.Close())
+
+			assert.Equal(t, []string{tt.backup, "app.log"}, dirFiles(t, dir))
+			assert.Equal(t, "first\nsecond\n", readFile(t, filepath.Join(dir, tt.backup)))
+			assert.Equal(t, "third\n", readFile(t, filepath.Join(dir, "app.log")))
+		})
+	}
+}
+
+func TestRotatingFile_SkipsEmptyScheduledRotation(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileSchedule(logged.RotateHourly), logged.FileClock(clock.Now))
+	assert.NoError(t, err)
+
+	clock.Add(time.Hour)
+	f.Write([]byte("first\n"))
+	clock.Add(10 * time.Minute)
+	f.Write([]byte("second\n"))
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{"app.log"}, dirFiles(t, dir))
+}
+
+func TestRotatingFile_AppendsToExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(path, []byte("existing\n"), 0644))
+
+	f, err := logged.NewRotatingFile(path)
+	assert.NoError(t, err)
+
+	f.Write([]byte("new\n"))
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, "existing\nnew\n", readFile(t, path))
+}
+
+func TestRotatingFile_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileClock(clock.Now))
+	assert.NoError(t, err)
+
+	assert.NoError(t, f.Rotate())
+	f.Write([]byte("first\n"))
+	assert.NoError(t, f.Rotate())
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{"app-2020-01-02T10-30-00.000.log", "app.log"}, dirFiles(t, dir))
+}
+
+func TestRotatingFile_MaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileMaxBackups(2), logged.FileClock(clock.Now))
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		f.Write([]byte("line\n"))
+		clock.Add(time.Minute)
+		f.Rotate()
+	}
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{
+		"app-2020-01-02T10-33-00.000.log",
+		"app-2020-01-02T10-34-00.000.log",
+		"app.log",
+	}, dirFiles(t, dir))
+}
+
+func TestRotatingFile_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileMaxAge(time.Hour), logged.FileClock(clock.Now))
+	assert.NoError(t, err)
+
+	f.Write([]byte("line\n"))
+	f.Rotate()
+	clock.Add(2 * time.Hour)
+	f.Write([]byte("line\n"))
+	f.Rotate()
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{"app-2020-01-02T12-30-00.000.log", "app.log"}, dirFiles(t, dir))
+}
+
+func TestRotatingFile_Compress(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock(time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC))
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileCompress(), logged.FileClock(clock.Now))
+	assert.NoError(t, err)
+
+	f.Write([]byte("first\n"))
+	f.Rotate()
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{"app-2020-01-02T10-30-00.000.log.gz", "app.log"}, dirFiles(t, dir))
+
+	file, err := os.Open(filepath.Join(dir, "app-2020-01-02T10-30-00.000.log.gz"))
+	assert.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	assert.NoError(t, err)
+	b, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(b))
+}
+
+func TestRotatingFile_WriteAfterClose(t *testing.T) {
+	f, err := logged.NewRotatingFile(filepath.Join(t.TempDir(), "app.log"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, f.Close())
+	assert.NoError(t, f.Close())
+
+	_, err = f.Write([]byte("line\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestRotatingFile_CloseAfterFailedRotate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"))
+	assert.NoError(t, err)
+	f.Write([]byte("first\n"))
+	assert.NoError(t, os.RemoveAll(dir))
+
+	assert.Error(t, f.Rotate())
+
+	done := make(chan error, 1)
+	go func() { done <- f.Close() }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked after a failed rotation")
+	}
+
+	_, err = f.Write([]byte("line\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestRotatingFile_WithBufferedStreamHandler(t *testing.T) {
+	dir := t.TempDir()
+	f, err := logged.NewRotatingFile(filepath.Join(dir, "app.log"), logged.FileMaxSize(64))
+	assert.NoError(t, err)
+	h := logged.BufferedStreamHandler(f, 2000, time.Hour, logged.LogfmtFormat())
+
+	h.Log("one", logged.Info, []interface{}{})
+	h.Log("two", logged.Info, []interface{}{})
+	h.Log("three", logged.Info, []interface{}{})
+	h.(logged.Flusher).Flush()
+	h.Log("four", logged.Info, []interface{}{})
+	h.Log("five", logged.Info, []interface{}{})
+	h.(io.Closer).Close()
+	assert.NoError(t, f.Close())
+
+	files := dirFiles(t, dir)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "lvl=info msg=one\nlvl=info msg=two\nlvl=info msg=three\n", readFile(t, filepath.Join(dir, files[0])))
+	assert.Equal(t, "lvl=info msg=four\nlvl=info msg=five\n", readFile(t, filepath.Join(dir, "app.log")))
+}
+
+func TestFileHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	h, err := logged.FileHandler(path, logged.LogfmtFormat())
+	assert.NoError(t, err)
+
+	h.Log("some message", logged.Error, []interface{}{"foo", "bar"})
+	assert.NoError(t, h.(io.Closer).Close())
+
+	assert.Equal(t, "lvl=eror msg=\"some message\" foo=bar\n", readFile(t, path))
+}
+
+func TestFileHandler_InvalidPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(t, os.Mkdir(path, 0755))
+
+	_, err := logged.FileHandler(path, logged.LogfmtFormat())
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,555 @@
+package logged
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CompareOp represents a numeric comparison operator.
+type CompareOp int
+
+// List of comparison operators.
+const (
+	OpEq CompareOp = iota
+	OpNe
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+)
+
+// And returns a filter that is true when all the filters are true.
+func And(fns ...FilterFunc) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		for _, fn := range fns {
+			if !fn(msg, lvl, ctx) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Or returns a filter that is true when any of the filters is true.
+func Or(fns ...FilterFunc) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		for _, fn := range fns {
+			if fn(msg, lvl, ctx) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Not returns a filter that is true when the filter is false.
+func Not(fn FilterFunc) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		return !fn(msg, lvl, ctx)
+	}
+}
+
+// HasKey returns a filter that is true when the context contains the key.
+func HasKey(key string) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		_, ok := lookupKey(ctx, key)
+		return ok
+	}
+}
+
+// MatchKey returns a filter that is true when the value of the key equals
+// the value. String values are compared with the formatted context value.
+func MatchKey(key string, value interface{}) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		v, ok := lookupKey(ctx, key)
+		return ok && valuesEqual(v, value)
+	}
+}
+
+// KeyRegex returns a filter that is true when the formatted value of the
+// key matches the regular expression.
+func KeyRegex(key string, re *regexp.Regexp) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		v, ok := lookupKey(ctx, key)
+		return ok && re.MatchString(stringValue(v))
+	}
+}
+
+// CompareKey returns a filter that is true when the value of the key is
+// numeric and compares to the value with the operator.
+func CompareKey(key string, op CompareOp, value float64) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		v, ok := lookupKey(ctx, key)
+		if !ok {
+			return false
+		}
+
+		f, ok := floatValue(v)
+		return ok && compare(f, op, value)
+	}
+}
+
+// MessagePrefix returns a filter that is true when the message has the prefix.
+func MessagePrefix(prefix string) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		return strings.HasPrefix(msg, prefix)
+	}
+}
+
+// MessageRegex returns a filter that is true when the message matches the
+// regular expression.
+func MessageRegex(re *regexp.Regexp) FilterFunc {
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		return re.MatchString(msg)
+	}
+}
+
+// LevelRange returns a filter that is true when the level is between the
+// given levels, inclusive.
+func LevelRange(from, to Level) FilterFunc {
+	if from > to {
+		from, to = to, from
+	}
+
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		return lvl >= from && lvl <= to
+	}
+}
+
+// lookupKey returns the value of the first occurrence of the key in ctx.
+func lookupKey(ctx []interface{}, key string) (interface{}, bool) {
+	for i := 0; i+1 < len(ctx); i += 2 {
+		if k, ok := ctx[i].(string); ok && k == key {
+			return ctx[i+1], true
+		}
+	}
+
+	return nil, false
+}
+
+// stringValue returns the string form of a value.
+func stringValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// floatValue returns the numeric value of a value, parsing strings.
+func floatValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
+// valuesEqual returns true if the context value equals the filter value.
+func valuesEqual(v, value interface{}) bool {
+	if s, ok := value.(string); ok {
+		return stringValue(v) == s
+	}
+
+	if vf, ok := floatValue(v); ok {
+		if f, ok := floatValue(value); ok {
+			return vf == f
+		}
+	}
+
+	if v == nil || value == nil {
+		return v == value
+	}
+
+	t := reflect.TypeOf(v)
+	return t == reflect.TypeOf(value) && t.Comparable() && v == value
+}
+
+func compare(a float64, op CompareOp, b float64) bool {
+	switch op {
+	case OpEq:
+		return a == b
+	case OpNe:
+		return a != b
+	case OpLt:
+		return a < b
+	case OpLe:
+		return a <= b
+	case OpGt:
+		return a > b
+	case OpGe:
+		return a >= b
+	default:
+		return false
+	}
+}
+
+// ParseFilter compiles a filter expression into a filter.
+//
+// An expression is made of comparisons joined by "&&" and "||", negated
+// with "!" and grouped with parentheses. A comparison is a key, an operator
+// and a value, such as `component="db"` or `latency_ms>500`. The operators
+// are "=", "!=", "<", "<=", ">", ">=", "~" (regular expression match), "!~"
+// and "^=" (prefix). A key without an operator is true when the context
+// contains the key. The "lvl" key compares the message level, with "lvl<=warn"
+// matching warnings and more severe messages, and the "msg" key compares the
+// message.
+func ParseFilter(expr string) (FilterFunc, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{toks: toks}
+	fn, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+
+	return fn, nil
+}
+
+const (
+	tokEOF = iota
+	tokWord
+	tokString
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type filterToken struct {
+	kind int
+	val  string
+	pos  int
+}
+
+// lexFilter splits a filter expression into tokens.
+func lexFilter(expr string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("log: invalid filter: unterminated string at position %d", i)
+			}
+
+			s, err := strconv.Unquote(expr[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("log: invalid filter: invalid string at position %d: %w", i, err)
+			}
+			toks = append(toks, filterToken{kind: tokString, val: s, pos: i})
+			i = j + 1
+
+		case strings.HasPrefix(expr[i:], "&&"):
+			toks = append(toks, filterToken{kind: tokAnd, val: "&&", pos: i})
+			i += 2
+
+		case strings.HasPrefix(expr[i:], "||"):
+			toks = append(toks, filterToken{kind: tokOr, val: "||", pos: i})
+			i += 2
+
+		case c == '(':
+			toks = append(toks, filterToken{kind: tokLParen, val: "(", pos: i})
+			i++
+
+		case c == ')':
+			toks = append(toks, filterToken{kind: tokRParen, val: ")", pos: i})
+			i++
+
+		case strings.ContainsRune("=!<>~^", rune(c)):
+			op := string(c)
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '!' && expr[i+1] == '~')) {
+				op = expr[i : i+2]
+			}
+
+			switch op {
+			case "!":
+				toks = append(toks, filterToken{kind: tokNot, val: op, pos: i})
+			case "^":
+				return nil, fmt.Errorf("log: invalid filter: unexpected %q at position %d", op, i)
+			default:
+				toks = append(toks, filterToken{kind: tokOp, val: op, pos: i})
+			}
+			i += len(op)
+
+		default:
+			j := i
+			for ; j < len(expr) && !strings.ContainsRune(" \t\n\r\"&|()=!<>~^", rune(expr[j])); j++ {
+			}
+			if j == i {
+				return nil, fmt.Errorf("log: invalid filter: unexpected %q at position %d", c, i)
+			}
+			toks = append(toks, filterToken{kind: tokWord, val: expr[i:j], pos: i})
+			i = j
+		}
+	}
+
+	return append(toks, filterToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.toks[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *filterParser) unexpected(t filterToken) error {
+	if t.kind == tokEOF {
+		return errors.New("log: invalid filter: unexpected end of expression")
+	}
+
+	return fmt.Errorf("log: invalid filter: unexpected %q at position %d", t.val, t.pos)
+}
+
+func (p *filterParser) parseOr() (FilterFunc, error) {
+	fn, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	fns := []FilterFunc{fn}
+	for p.peek().kind == tokOr {
+		p.next()
+
+		fn, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, fn)
+	}
+
+	if len(fns) == 1 {
+		return fns[0], nil
+	}
+
+	return Or(fns...), nil
+}
+
+func (p *filterParser) parseAnd() (FilterFunc, error) {
+	fn, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	fns := []FilterFunc{fn}
+	for p.peek().kind == tokAnd {
+		p.next()
+
+		fn, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, fn)
+	}
+
+	if len(fns) == 1 {
+		return fns[0], nil
+	}
+
+	return And(fns...), nil
+}
+
+func (p *filterParser) parseUnary() (FilterFunc, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		fn, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(fn), nil
+
+	case tokLParen:
+		fn, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, p.unexpected(t)
+		}
+		return fn, nil
+
+	case tokWord, tokString:
+		if p.peek().kind != tokOp {
+			return HasKey(t.val), nil
+		}
+
+		op := p.next()
+		val := p.next()
+		if val.kind != tokWord && val.kind != tokString {
+			return nil, p.unexpected(val)
+		}
+
+		return compileComparison(t.val, op, val)
+
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// compileComparison returns the filter for a single comparison.
+func compileComparison(key string, op, val filterToken) (FilterFunc, error) {
+	switch key {
+	case LevelKey:
+		return compileLevelComparison(op, val)
+	case MessageKey:
+		return compileMessageComparison(op, val)
+	}
+
+	switch op.val {
+	case "=", "==", "!=":
+		var value interface{} = val.val
+		if val.kind == tokWord {
+			if f, err := strconv.ParseFloat(val.val, 64); err == nil {
+				value = f
+			}
+		}
+
+		fn := MatchKey(key, value)
+		if op.val == "!=" {
+			fn = Not(fn)
+		}
+		return fn, nil
+
+	case "<", "<=", ">", ">=":
+		f, err := strconv.ParseFloat(val.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("log: invalid filter: invalid number %q at position %d", val.val, val.pos)
+		}
+		return CompareKey(key, compareOps[op.val], f), nil
+
+	case "~", "!~":
+		re, err := regexp.Compile(val.val)
+		if err != nil {
+			return nil, fmt.Errorf("log: invalid filter: invalid regular expression at position %d: %w", val.pos, err)
+		}
+
+		fn := KeyRegex(key, re)
+		if op.val == "!~" {
+			fn = Not(fn)
+		}
+		return fn, nil
+
+	case "^=":
+		prefix := val.val
+		return func(msg string, lvl Level, ctx []interface{}) bool {
+			v, ok := lookupKey(ctx, key)
+			return ok && strings.HasPrefix(stringValue(v), prefix)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("log: invalid filter: unexpected %q at position %d", op.val, op.pos)
+}
+
+func compileLevelComparison(op, val filterToken) (FilterFunc, error) {
+	l, err := LevelFromString(strings.ToLower(val.val))
+	if err != nil {
+		return nil, fmt.Errorf("log: invalid filter: invalid level %q at position %d", val.val, val.pos)
+	}
+
+	cmpOp, ok := compareOps[op.val]
+	if !ok {
+		return nil, fmt.Errorf("log: invalid filter: unexpected %q at position %d", op.val, op.pos)
+	}
+
+	return func(msg string, lvl Level, ctx []interface{}) bool {
+		return compare(float64(lvl), cmpOp, float64(l))
+	}, nil
+}
+
+func compileMessageComparison(op, val filterToken) (FilterFunc, error) {
+	s := val.val
+	switch op.val {
+	case "=", "==":
+		return func(msg string, lvl Level, ctx []interface{}) bool {
+			return msg == s
+		}, nil
+
+	case "!=":
+		return func(msg string, lvl Level, ctx []interface{}) bool {
+			return msg != s
+		}, nil
+
+	case "~", "!~":
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("log: invalid filter: invalid regular expression at position %d: %w", val.pos, err)
+		}
+
+		fn := MessageRegex(re)
+		if op.val == "!~" {
+			fn = Not(fn)
+		}
+		return fn, nil
+
+	case "^=":
+		return MessagePrefix(s), nil
+	}
+
+	return nil, fmt.Errorf("log: invalid filter: unexpected %q at position %d", op.val, op.pos)
+}
+
+var compareOps = map[string]CompareOp{
+	"=":  OpEq,
+	"==": OpEq,
+	"!=": OpNe,
+	"<":  OpLt,
+	"<=": OpLe,
+	">":  OpGt,
+	">=": OpGe,
+}
@@ -0,0 +1,132 @@
+package logged_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAndOrNot(t *testing.T) {
+	yes := func(msg string, lvl logged.Level, ctx []interface{}) bool { return true }
+	no := func(msg string, lvl logged.Level, ctx []interface{}) bool { return false }
+
+	assert.True(t, logged.And(yes, yes)("", logged.Info, nil))
+	assert.False(t, logged.And(yes, no)("", logged.Info, nil))
+	assert.True(t, logged.And()("", logged.Info, nil))
+	assert.True(t, logged.Or(no, yes)("", logged.Info, nil))
+	assert.False(t, logged.Or(no, no)("", logged.Info, nil))
+	assert.False(t, logged.Or()("", logged.Info, nil))
+	assert.True(t, logged.Not(no)("", logged.Info, nil))
+}
+
+func TestKeyFilters(t *testing.T) {
+	ctx := []interface{}{"component", "db", "status", 200, "latency_ms", 750.5, "component", "http"}
+
+	tests := []struct {
+		name string
+		fn   logged.FilterFunc
+		want bool
+	}{
+		{"HasKey", logged.HasKey("status"), true},
+		{"HasKeyMissing", logged.HasKey("foo"), false},
+		{"MatchKeyString", logged.MatchKey("component", "db"), true},
+		{"MatchKeyFirstOccurrence", logged.MatchKey("component", "http"), false},
+		{"MatchKeyStringified", logged.MatchKey("status", "200"), true},
+		{"MatchKeyNumeric", logged.MatchKey("status", 200.0), true},
+		{"MatchKeyMissing", logged.MatchKey("foo", "db"), false},
+		{"KeyRegex", logged.KeyRegex("component", regexp.MustCompile("^d")), true},
+		{"KeyRegexNoMatch", logged.KeyRegex("component", regexp.MustCompile("^h")), false},
+		{"CompareKeyGt", logged.CompareKey("latency_ms", logged.OpGt, 500), true},
+		{"CompareKeyLe", logged.CompareKey("status", logged.OpLe, 199), false},
+		{"CompareKeyNotNumeric", logged.CompareKey("component", logged.OpNe, 1), false},
+		{"CompareKeyMissing", logged.CompareKey("foo", logged.OpNe, 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.fn("some message", logged.Info, ctx))
+		})
+	}
+}
+
+func TestMessageFilters(t *testing.T) {
+	assert.True(t, logged.MessagePrefix("db:")("db: ping", logged.Info, nil))
+	assert.False(t, logged.MessagePrefix("db:")("http: ping", logged.Info, nil))
+	assert.True(t, logged.MessageRegex(regexp.MustCompile("p[io]ng"))("db: ping", logged.Info, nil))
+	assert.False(t, logged.MessageRegex(regexp.MustCompile("^ping"))("db: ping", logged.Info, nil))
+}
+
+func TestLevelRange(t *testing.T) {
+	fn := logged.LevelRange(logged.Warn, logged.Error)
+
+	assert.False(t, fn("", logged.Crit, nil))
+	assert.True(t, fn("", logged.Error, nil))
+	assert.True(t, fn("", logged.Warn, nil))
+	assert.False(t, fn("", logged.Info, nil))
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		msg  string
+		lvl  logged.Level
+		ctx  []interface{}
+		want bool
+	}{
+		{`lvl<=warn && component="db" && !msg~"ping"`, "query failed", logged.Error, []interface{}{"component", "db"}, true},
+		{`lvl<=warn && component="db" && !msg~"ping"`, "ping failed", logged.Error, []interface{}{"component", "db"}, false},
+		{`lvl<=warn && component="db" && !msg~"ping"`, "query failed", logged.Info, []interface{}{"component", "db"}, false},
+		{`lvl<=warn && component="db" && !msg~"ping"`, "query failed", logged.Error, []interface{}{"component", "http"}, false},
+		{`latency_ms > 500`, "", logged.Info, []interface{}{"latency_ms", 750}, true},
+		{`latency_ms > 500`, "", logged.Info, []interface{}{"latency_ms", 250}, false},
+		{`latency_ms>=500 || status!=200`, "", logged.Info, []interface{}{"latency_ms", 250, "status", 500}, true},
+		{`status == 200`, "", logged.Info, []interface{}{"status", "200"}, true},
+		{`a || b && c`, "", logged.Info, []interface{}{"a", 1}, true},
+		{`(a || b) && c`, "", logged.Info, []interface{}{"a", 1}, false},
+		{`!(a)`, "", logged.Info, []interface{}{"a", 1}, false},
+		{`path ^= "/api/"`, "", logged.Info, []interface{}{"path", "/api/users"}, true},
+		{`path !~ "^/api"`, "", logged.Info, []interface{}{"path", "/api/users"}, false},
+		{`msg ^= "db:"`, "db: ping", logged.Info, nil, true},
+		{`msg != "db: ping"`, "db: ping", logged.Info, nil, false},
+		{`lvl = ERROR`, "", logged.Error, nil, true},
+		{`lvl > info`, "", logged.Debug, nil, true},
+		{`name = "say \"hi\""`, "", logged.Info, []interface{}{"name", `say "hi"`}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			fn, err := logged.ParseFilter(tt.expr)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, fn(tt.msg, tt.lvl, tt.ctx))
+		})
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	tests := []string{
+		``,
+		`a &&`,
+		`(a || b`,
+		`a b`,
+		`a = `,
+		`lvl <= loud`,
+		`lvl ~ "warn"`,
+		`msg < 5`,
+		`latency_ms > fast`,
+		`path ~ "("`,
+		`name = "unterminated`,
+		`a ^ b`,
+		`a & b`,
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			_, err := logged.ParseFilter(expr)
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package logged
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FluentForwardMode represents how entries are sent with the Fluentd Forward
+// protocol.
+type FluentForwardMode int
+
+// List of modes.
+const (
+	// FluentForward batches the entries of a tag, sending them as an array.
+	FluentForward FluentForwardMode = iota
+	// FluentPackedForward batches the entries of a tag, sending them as a
+	// single binary string.
+	FluentPackedForward
+	// FluentMessage sends each entry on its own as soon as it is logged.
+	FluentMessage
+)
+
+// FluentOption represents an option for the fluent handler.
+type FluentOption func(*fluentHandler)
+
+// FluentTag sets the tag of entries that do not set their own. The default
+// is the program name.
+func FluentTag(tag string) FluentOption {
+	return func(h *fluentHandler) {
+		h.tag = tag
+	}
+}
+
+// FluentTagField sets the context key holding the tag of an entry, allowing
+// a logger to set its own tag. The key is not added to the record. The
+// default is "fluent_tag".
+func FluentTagField(key string) FluentOption {
+	return func(h *fluentHandler) {
+		h.tagKey = key
+	}
+}
+
+// FluentMode sets how entries are sent. The default is FluentForward.
+func FluentMode(m FluentForwardMode) FluentOption {
+	return func(h *fluentHandler) {
+		h.mode = m
+	}
+}
+
+// FluentBatch sets the size in bytes at which batched entries are sent, and
+// the interval at which they are sent regardless. The defaults are 64KB and
+// 1 second.
+func FluentBatch(maxBytes int, interval time.Duration) FluentOption {
+	return func(h *fluentHandler) {
+		h.batchBytes = maxBytes
+		h.interval = interval
+	}
+}
+
+// FluentRequireAck requests an acknowledgement for each chunk of entries,
+// waiting up to the timeout for it. A chunk that is not acknowledged is
+// sent once more on a new connection.
+func FluentRequireAck(timeout time.Duration) FluentOption {
+	return func(h *fluentHandler) {
+		h.ack = true
+		h.ackTimeout = timeout
+	}
+}
+
+// FluentTLSConfig sets the TLS configuration used by the "tls" network.
+func FluentTLSConfig(cfg *tls.Config) FluentOption {
+	return func(h *fluentHandler) {
+		h.tlsConfig = cfg
+	}
+}
+
+// FluentDialTimeout sets the maximum time to wait for a connection. The
+// default is 5 seconds.
+func FluentDialTimeout(d time.Duration) FluentOption {
+	return func(h *fluentHandler) {
+		h.dialTimeout = d
+	}
+}
+
+// FluentWriteTimeout sets the maximum time a write may take.
+func FluentWriteTimeout(d time.Duration) FluentOption {
+	return func(h *fluentHandler) {
+		h.conn.timeout = d
+	}
+}
+
+// FluentBackoff sets the minimum and maximum time to wait before
+// reconnecting after a failed connection. The defaults are 100ms and 30s.
+func FluentBackoff(minDelay, maxDelay time.Duration) FluentOption {
+	return func(h *fluentHandler) {
+		h.conn.minBackoff = minDelay
+		h.conn.maxBackoff = maxDelay
+	}
+}
+
+// FluentErrorHandler sets the function called when sending fails. By
+// default errors are reported to the package error handler.
+func FluentErrorHandler(fn func(error)) FluentOption {
+	return func(h *fluentHandler) {
+		h.onError = fn
+	}
+}
+
+// fluentBatch holds the encoded entries of a tag.
+type fluentBatch struct {
+	entries []byte
+	count   int
+}
+
+type fluentHandler struct {
+	tag         string
+	tagKey      string
+	mode        FluentForwardMode
+	batchBytes  int
+	interval    time.Duration
+	ack         bool
+	ackTimeout  time.Duration
+	dialTimeout time.Duration
+	tlsConfig   *tls.Config
+	onError     func(error)
+
+	conn   *netConn
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	batches map[string]*fluentBatch
+	order   []string
+	size    int
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// FluentHandler returns a handler that sends log messages to fluentd or
+// fluent-bit with the Forward protocol. The network is one of "tcp",
+// "unix" or "tls". Each record holds the message, the level and the
+// context. The connection is made on the first message and reestablished
+// with backoff when it fails.
+func FluentHandler(network, addr string, opts ...FluentOption) (Handler, error) {
+	h := &fluentHandler{
+		tag:         filepath.Base(os.Args[0]),
+		tagKey:      "fluent_tag",
+		mode:        FluentForward,
+		batchBytes:  64 << 10,
+		interval:    time.Second,
+		dialTimeout: 5 * time.Second,
+		batches:     map[string]*fluentBatch{},
+		done:        make(chan struct{}),
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		h.conn = newNetConn(func() (net.Conn, error) {
+			return net.DialTimeout(network, addr, h.dialTimeout)
+		})
+	case "tls":
+		h.conn = newNetConn(func() (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: h.dialTimeout}, "tcp", addr, h.tlsConfig)
+		})
+	default:
+		return nil, fmt.Errorf("log: unsupported fluent network: %s", network)
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.mode != FluentMessage {
+		if h.interval <= 0 {
+			return nil, fmt.Errorf("log: invalid fluent batch interval: %s", h.interval)
+		}
+
+		h.wg.Add(1)
+		go h.run()
+	}
+
+	return h, nil
+}
+
+func (h *fluentHandler) run() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.Flush()
+
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Log write the log message.
+func (h *fluentHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	h.TryLog(msg, lvl, ctx)
+}
+
+// TryLog sends the log message, returning an error if it could not be sent.
+// Batched messages are only added to the batch, failing if the handler is
+// closed.
+func (h *fluentHandler) TryLog(msg string, lvl Level, ctx []interface{}) error {
+	tag := h.tag
+	if v, ok := lookupKey(ctx, h.tagKey); ok {
+		tag = stringValue(v)
+	}
+
+	if h.mode == FluentMessage {
+		h.sendMu.Lock()
+		defer h.sendMu.Unlock()
+
+		b := appendMsgpackArrayHeader(nil, 3+boolToInt(h.ack))
+		b = appendMsgpackString(b, tag)
+		b = h.appendEvent(b, msg, lvl, ctx)
+
+		var id string
+		if h.ack {
+			id = newFluentChunkID()
+			b = appendMsgpackMapHeader(b, 1)
+			b = appendMsgpackString(b, "chunk")
+			b = appendMsgpackString(b, id)
+		}
+
+		return h.send(b, id)
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return fmt.Errorf("log: write to closed fluent handler: %w", net.ErrClosed)
+	}
+
+	batch, ok := h.batches[tag]
+	if !ok {
+		batch = &fluentBatch{}
+		h.batches[tag] = batch
+		h.order = append(h.order, tag)
+	}
+	n := len(batch.entries)
+	batch.entries = appendMsgpackArrayHeader(batch.entries, 2)
+	batch.entries = h.appendEvent(batch.entries, msg, lvl, ctx)
+	batch.count++
+	h.size += len(batch.entries) - n
+	full := h.size >= h.batchBytes
+	h.mu.Unlock()
+
+	if full {
+		return h.Flush()
+	}
+
+	return nil
+}
+
+// appendEvent appends the time and the record of an entry.
+func (h *fluentHandler) appendEvent(b []byte, msg string, lvl Level, ctx []interface{}) []byte {
+	b = appendMsgpackEventTime(b, time.Now())
+
+	// The number of fields is only known once the context is encoded
+	fields := make([]byte, 0, 64)
+	fields = appendMsgpackString(fields, MessageKey)
+	fields = appendMsgpackString(fields, msg)
+	fields = appendMsgpackString(fields, LevelKey)
+	fields = appendMsgpackString(fields, lvl.String())
+	count := 2
+
+	for i := 0; i+1 < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		if !ok {
+			fields = appendMsgpackString(fields, errorKey)
+			fields = appendMsgpackValue(fields, ctx[i])
+			count++
+			continue
+		}
+		if k == h.tagKey {
+			continue
+		}
+
+		fields = appendMsgpackString(fields, k)
+		fields = appendMsgpackValue(fields, ctx[i+1])
+		count++
+
+		if err, ok := ctx[i+1].(error); ok {
+			if causes := errorCauses(err); len(causes) > 0 {
+				fields = appendMsgpackString(fields, k+CausesSuffix)
+				fields = appendMsgpackValue(fields, causes)
+				count++
+			}
+		}
+	}
+
+	b = appendMsgpackMapHeader(b, count)
+	return append(b, fields...)
+}
+
+// Flush sends the batched messages, one chunk per tag. Chunks that could not
+// be sent are dropped and the error is returned.
+func (h *fluentHandler) Flush() error {
+	h.sendMu.Lock()
+	defer h.sendMu.Unlock()
+
+	h.mu.Lock()
+	batches, order := h.batches, h.order
+	h.batches, h.order, h.size = map[string]*fluentBatch{}, nil, 0
+	h.mu.Unlock()
+
+	var err error
+	for _, tag := range order {
+		batch := batches[tag]
+
+		b := appendMsgpackArrayHeader(nil, 3)
+		b = appendMsgpackString(b, tag)
+		if h.mode == FluentPackedForward {
+			b = appendMsgpackBin(b, batch.entries)
+		} else {
+			b = appendMsgpackArrayHeader(b, batch.count)
+			b = append(b, batch.entries...)
+		}
+
+		var id string
+		b = appendMsgpackMapHeader(b, 1+boolToInt(h.ack))
+		b = appendMsgpackString(b, "size")
+		b = appendMsgpackInt(b, int64(batch.count))
+		if h.ack {
+			id = newFluentChunkID()
+			b = appendMsgpackString(b, "chunk")
+			b = appendMsgpackString(b, id)
+		}
+
+		if serr := h.send(b, id); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	return err
+}
+
+// send sends the chunk, waiting for its acknowledgement if it has an id. It
+// must be called with the send lock held.
+func (h *fluentHandler) send(b []byte, id string) error {
+	var reply func(conn net.Conn) error
+	if id != "" {
+		reply = func(conn net.Conn) error {
+			return readFluentAck(conn, id, h.ackTimeout)
+		}
+	}
+
+	if _, err := h.conn.send(b, reply); err != nil {
+		err = fmt.Errorf("log: could not send fluent chunk: %w", err)
+		h.report(err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fluentHandler) report(err error) {
+	if h.onError != nil {
+		h.onError(err)
+		return
+	}
+
+	reportError(err)
+}
+
+// Close sends the batched messages and closes the connection.
+func (h *fluentHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.mu.Unlock()
+
+	var err error
+	if h.mode != FluentMessage {
+		close(h.done)
+		h.wg.Wait()
+
+		err = h.Flush()
+	}
+
+	if cerr := h.conn.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// newFluentChunkID returns a random chunk id, encoded in base64.
+func newFluentChunkID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// readFluentAck reads the acknowledgement of a chunk, a map holding the
+// chunk id in its "ack" key.
+func readFluentAck(conn net.Conn, id string, timeout time.Duration) error {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	r := bufio.NewReader(conn)
+	n, err := readMsgpackMapHeader(r)
+	if err != nil {
+		return fmt.Errorf("log: could not read fluent ack: %w", err)
+	}
+
+	var ack string
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackString(r)
+		if err != nil {
+			return fmt.Errorf("log: could not read fluent ack: %w", err)
+		}
+		v, err := readMsgpackString(r)
+		if err != nil {
+			return fmt.Errorf("log: could not read fluent ack: %w", err)
+		}
+
+		if k == "ack" {
+			ack = v
+		}
+	}
+
+	if ack != id {
+		return fmt.Errorf("log: unexpected fluent ack %q for chunk %q", ack, id)
+	}
+
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,374 @@
+package logged_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventTime is a decoded Fluentd EventTime.
+type eventTime struct {
+	sec, nsec uint32
+}
+
+// decodeMsgpack decodes a single MessagePack value.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	readN := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	readLen := func(size int) (int, error) {
+		b, err := readN(size)
+		if err != nil {
+			return 0, err
+		}
+		var n uint64
+		for _, x := range b {
+			n = n<<8 | uint64(x)
+		}
+		return int(n), nil
+	}
+	readArray := func(n int) (interface{}, error) {
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	readMap := func(n int) (interface{}, error) {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[fmt.Sprint(k)], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	switch {
+	case c < 0x80:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return readMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return readArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		b, err := readN(int(c & 0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readLen(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readN(n)
+	case 0xcb:
+		b, err := readN(8)
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readLen(1 << (c - 0xcc))
+		return int64(n), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := readLen(size)
+		return int64(n) << (64 - 8*size) >> (64 - 8*size), err
+	case 0xd7:
+		b, err := readN(9)
+		if err != nil {
+			return nil, err
+		}
+		return eventTime{binary.BigEndian.Uint32(b[1:5]), binary.BigEndian.Uint32(b[5:9])}, nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := readLen(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := readN(n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := readLen(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readArray(n)
+	case 0xde, 0xdf:
+		n, err := readLen(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMap(n)
+	}
+
+	return nil, fmt.Errorf("unsupported msgpack type 0x%x", c)
+}
+
+// fluentServer receives Forward protocol chunks, acknowledging those that
+// ask for it unless ack returns false.
+func fluentServer(t *testing.T, ack func(chunk string) bool) (string, chan []interface{}) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan []interface{}, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				for {
+					v, err := decodeMsgpack(r)
+					if err != nil {
+						return
+					}
+					frame := v.([]interface{})
+					ch <- frame
+
+					opt, ok := frame[len(frame)-1].(map[string]interface{})
+					if !ok || opt["chunk"] == nil {
+						continue
+					}
+					if ack != nil && !ack(opt["chunk"].(string)) {
+						return
+					}
+
+					var b []byte
+					b = append(b, 0x81, 0xa3)
+					b = append(b, "ack"...)
+					b = append(b, 0xd9, byte(len(opt["chunk"].(string))))
+					b = append(b, opt["chunk"].(string)...)
+					conn.Write(b)
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), ch
+}
+
+func receiveFrame(t *testing.T, ch chan []interface{}) []interface{} {
+	select {
+	case f := <-ch:
+		return f
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for chunk")
+		return nil
+	}
+}
+
+func decodeEntries(t *testing.T, b []byte) []interface{} {
+	var entries []interface{}
+	r := bufio.NewReader(bytes.NewReader(b))
+	for {
+		e, err := decodeMsgpack(r)
+		if err == io.EOF {
+			return entries
+		}
+		assert.NoError(t, err)
+		entries = append(entries, e)
+	}
+}
+
+func TestFluentHandler_Message(t *testing.T) {
+	addr, ch := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentTag("app"), logged.FluentMode(logged.FluentMessage))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	err = h.(logged.FallibleHandler).TryLog("some message", logged.Warn, []interface{}{"foo", "bar", "n", 2, "err", errors.Join(errors.New("a"), errors.New("b"))})
+
+	assert.NoError(t, err)
+	f := receiveFrame(t, ch)
+	assert.Len(t, f, 3)
+	assert.Equal(t, "app", f[0])
+	assert.InDelta(t, time.Now().Unix(), int64(f[1].(eventTime).sec), 5)
+	assert.Equal(t, map[string]interface{}{
+		"msg":        "some message",
+		"lvl":        "warn",
+		"foo":        "bar",
+		"n":          int64(2),
+		"err":        "a\nb",
+		"err.causes": []interface{}{"a", "b"},
+	}, f[2])
+}
+
+func TestFluentHandler_Forward(t *testing.T) {
+	addr, ch := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentTag("app"), logged.FluentBatch(1<<20, time.Hour))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	db := logged.New(h, "fluent_tag", "app.db")
+	h.Log("first", logged.Info, []interface{}{})
+	db.Info("query", "rows", 3)
+	h.Log("second", logged.Debug, []interface{}{})
+	assert.NoError(t, h.(logged.Flusher).Flush())
+
+	f := receiveFrame(t, ch)
+	assert.Equal(t, "app", f[0])
+	entries := f[1].([]interface{})
+	assert.Len(t, entries, 2)
+	assert.Equal(t, map[string]interface{}{"msg": "first", "lvl": "info"}, entries[0].([]interface{})[1])
+	assert.Equal(t, map[string]interface{}{"msg": "second", "lvl": "dbug"}, entries[1].([]interface{})[1])
+	assert.Equal(t, map[string]interface{}{"size": int64(2)}, f[2])
+
+	f = receiveFrame(t, ch)
+	assert.Equal(t, "app.db", f[0])
+	entries = f[1].([]interface{})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{"msg": "query", "lvl": "info", "rows": int64(3)}, entries[0].([]interface{})[1])
+}
+
+func TestFluentHandler_PackedForward(t *testing.T) {
+	addr, ch := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentTag("app"), logged.FluentMode(logged.FluentPackedForward))
+	assert.NoError(t, err)
+
+	h.Log("first", logged.Info, []interface{}{})
+	h.Log("second", logged.Info, []interface{}{})
+	assert.NoError(t, h.(io.Closer).Close())
+
+	f := receiveFrame(t, ch)
+	assert.Equal(t, "app", f[0])
+	entries := decodeEntries(t, f[1].([]byte))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "first", entries[0].([]interface{})[1].(map[string]interface{})["msg"])
+	assert.Equal(t, "second", entries[1].([]interface{})[1].(map[string]interface{})["msg"])
+	assert.Equal(t, int64(2), f[2].(map[string]interface{})["size"])
+}
+
+func TestFluentHandler_FlushesFullBatch(t *testing.T) {
+	addr, ch := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentBatch(1, time.Hour))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	assert.Len(t, receiveFrame(t, ch)[1], 1)
+}
+
+func TestFluentHandler_FlushesOnInterval(t *testing.T) {
+	addr, ch := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentBatch(1<<20, 10*time.Millisecond))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	assert.Len(t, receiveFrame(t, ch)[1], 1)
+}
+
+func TestFluentHandler_Ack(t *testing.T) {
+	addr, ch := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentBatch(1<<20, time.Hour), logged.FluentRequireAck(time.Second))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	assert.NoError(t, h.(logged.Flusher).Flush())
+	opt := receiveFrame(t, ch)[2].(map[string]interface{})
+	assert.Equal(t, int64(1), opt["size"])
+	assert.NotEmpty(t, opt["chunk"])
+}
+
+func TestFluentHandler_RetriesUnacknowledgedChunk(t *testing.T) {
+	var n atomic.Int32
+	addr, ch := fluentServer(t, func(string) bool {
+		// The connection is dropped before the second chunk is acknowledged
+		return n.Add(1) != 2
+	})
+	h, err := logged.FluentHandler("tcp", addr, logged.FluentMode(logged.FluentMessage), logged.FluentRequireAck(time.Second))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("first", logged.Info, []interface{}{})
+	receiveFrame(t, ch)
+
+	err = h.(logged.FallibleHandler).TryLog("second", logged.Info, []interface{}{})
+
+	assert.NoError(t, err)
+	f1, f2 := receiveFrame(t, ch), receiveFrame(t, ch)
+	assert.Equal(t, "second", f1[2].(map[string]interface{})["msg"])
+	assert.Equal(t, f1, f2)
+	assert.Equal(t, int32(3), n.Load())
+}
+
+func TestFluentHandler_AckTimeout(t *testing.T) {
+	addr, _ := fluentServer(t, func(string) bool {
+		time.Sleep(100 * time.Millisecond)
+		return true
+	})
+	var errs []error
+	h, err := logged.FluentHandler("tcp", addr,
+		logged.FluentMode(logged.FluentMessage),
+		logged.FluentRequireAck(10*time.Millisecond),
+		logged.FluentErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	err = h.(logged.FallibleHandler).TryLog("some message", logged.Info, []interface{}{})
+
+	assert.Error(t, err)
+	assert.Len(t, errs, 1)
+}
+
+func TestFluentHandler_Close(t *testing.T) {
+	addr, _ := fluentServer(t, nil)
+	h, err := logged.FluentHandler("tcp", addr)
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.(io.Closer).Close())
+	assert.NoError(t, h.(io.Closer).Close())
+
+	err = h.(logged.FallibleHandler).TryLog("some message", logged.Info, []interface{}{})
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestFluentHandler_InvalidOptions(t *testing.T) {
+	_, err := logged.FluentHandler("udp", "127.0.0.1:24224")
+	assert.Error(t, err)
+
+	_, err = logged.FluentHandler("tcp", "127.0.0.1:24224", logged.FluentBatch(1024, 0))
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package logged
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -10,6 +11,8 @@ const (
 	LevelKey = "lvl"
 	// MessageKey is the key used for message descriptions.
 	MessageKey = "msg"
+	// CallerKey is the key used for the caller of a message, as "file:line".
+	CallerKey = "caller"
 
 	timeFormat = "2006-01-02T15:04:05-0700" // ISO8601 format
 )
@@ -53,6 +56,11 @@ func JSONFormat() Formatter {
 				continue
 			}
 
+			if err, ok := ctx[i+1].(error); ok {
+				formatJSONError(buf, k, err)
+				continue
+			}
+
 			buf.WriteString(`"` + k + `"`)
 			buf.WriteByte(':')
 			formatJSONValue(buf, ctx[i+1])
@@ -105,11 +113,33 @@ func formatJSONValue(buf *buffer, value interface{}) {
 		buf.AppendUint(v)
 	case string:
 		quoteString(buf, v)
+	case SecretValue:
+		quoteString(buf, v.String())
 	default:
 		quoteString(buf, fmt.Sprintf("%+v", value))
 	}
 }
 
+// formatJSONError formats an error and its cause chain, adding it to the buffer.
+func formatJSONError(buf *buffer, key string, err error) {
+	buf.WriteString(`"` + key + `":`)
+	quoteString(buf, errorMessage(err))
+
+	causes := errorCauses(err)
+	if len(causes) == 0 {
+		return
+	}
+
+	buf.WriteString(`,"` + key + CausesSuffix + `":[`)
+	for i, cause := range causes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		quoteString(buf, cause)
+	}
+	buf.WriteByte(']')
+}
+
 var logfmtPool = newPool(512)
 
 // LogfmtFormat formats a log line in logfmt format.
@@ -134,6 +164,11 @@ func LogfmtFormat() Formatter {
 				continue
 			}
 
+			if err, ok := ctx[i+1].(error); ok {
+				formatLogfmtError(buf, k, err)
+				continue
+			}
+
 			buf.WriteString(k)
 			buf.WriteByte('=')
 			formatLogfmtValue(buf, ctx[i+1])
@@ -183,11 +218,28 @@ func formatLogfmtValue(buf *buffer, value interface{}) {
 		buf.AppendUint(v)
 	case string:
 		logfmtQuoteString(buf, v)
+	case SecretValue:
+		logfmtQuoteString(buf, v.String())
 	default:
 		logfmtQuoteString(buf, fmt.Sprintf("%+v", value))
 	}
 }
 
+// formatLogfmtError formats an error and its cause chain, adding it to the buffer.
+func formatLogfmtError(buf *buffer, key string, err error) {
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	logfmtQuoteString(buf, errorMessage(err))
+
+	causes := errorCauses(err)
+	if len(causes) == 0 {
+		return
+	}
+
+	buf.WriteString(" " + key + CausesSuffix + "=")
+	logfmtQuoteString(buf, strings.Join(causes, "; "))
+}
+
 func logfmtQuoteString(buf *buffer, s string) {
 	needsQuotes := false
 	for _, r := range s {
@@ -232,3 +284,24 @@ func escapeString(buf *buffer, s string) {
 		}
 	}
 }
+
+// formatPlainValue returns a value as an unquoted string, formatting numbers
+// and times as the other formats do.
+func formatPlainValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case SecretValue:
+		return v.String()
+	case error:
+		return errorMessage(v)
+	case time.Time, bool, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		buf := &buffer{}
+		formatLogfmtValue(buf, v)
+		return string(buf.Bytes())
+	default:
+		return fmt.Sprintf("%+v", value)
+	}
+}
@@ -2,6 +2,8 @@ package logged_test
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -168,3 +170,77 @@ func TestLogfmtFormat_Unknown(t *testing.T) {
 	expect := []byte(`lvl=eror msg= what={Name:test} nil=` + "\n")
 	assert.Equal(t, expect, b)
 }
+
+func TestJsonFormat_Error(t *testing.T) {
+	f := logged.JSONFormat()
+
+	b := f.Format("", logged.Error, []interface{}{"err", errors.New("test error")})
+
+	expect := []byte(`{"lvl":"eror","msg":"","err":"test error"}` + "\n")
+	assert.Equal(t, expect, b)
+}
+
+func TestJsonFormat_ErrorCauses(t *testing.T) {
+	inner := logged.WrapError(errors.New("inner"), "a", 1)
+	err := fmt.Errorf("outer: %w", errors.Join(inner, errors.New("other")))
+	f := logged.JSONFormat()
+
+	b := f.Format("", logged.Error, []interface{}{"err", err})
+
+	expect := []byte(`{"lvl":"eror","msg":"","err":"outer: inner\nother","err.causes":["inner\nother","inner","other"]}` + "\n")
+	assert.Equal(t, expect, b)
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(b, &m)
+	assert.NoError(t, err)
+}
+
+func TestLogfmtFormat_Error(t *testing.T) {
+	f := logged.LogfmtFormat()
+
+	b := f.Format("", logged.Error, []interface{}{"err", errors.New("test")})
+
+	expect := []byte(`lvl=eror msg= err=test` + "\n")
+	assert.Equal(t, expect, b)
+}
+
+func TestLogfmtFormat_ErrorCauses(t *testing.T) {
+	err := fmt.Errorf("outer: %w", fmt.Errorf("middle: %w", errors.New("inner")))
+	f := logged.LogfmtFormat()
+
+	b := f.Format("", logged.Error, []interface{}{"err", err})
+
+	expect := []byte(`lvl=eror msg= err="outer: middle: inner" err.causes="middle: inner; inner"` + "\n")
+	assert.Equal(t, expect, b)
+}
+
+type nilError struct {
+	msg   string
+	cause error
+}
+
+func (e *nilError) Error() string {
+	return e.msg
+}
+
+func (e *nilError) Unwrap() error {
+	return e.cause
+}
+
+func TestJsonFormat_TypedNilError(t *testing.T) {
+	var err *nilError
+	f := logged.JSONFormat()
+
+	b := f.Format("some message", logged.Error, []interface{}{"err", err})
+
+	assert.Equal(t, `{"lvl":"eror","msg":"some message","err":"<nil>"}`+"\n", string(b))
+}
+
+func TestLogfmtFormat_TypedNilError(t *testing.T) {
+	var err *nilError
+	f := logged.LogfmtFormat()
+
+	b := f.Format("some message", logged.Error, []interface{}{"err", err})
+
+	assert.Equal(t, `lvl=eror msg="some message" err=<nil>`+"\n", string(b))
+}
@@ -0,0 +1,334 @@
+package logged
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	gelfChunkHeaderSize = 12
+	gelfMaxChunks       = 128
+)
+
+// Compression represents a compression algorithm.
+type Compression int
+
+// List of compressions.
+const (
+	CompressGzip Compression = iota
+	CompressZlib
+	CompressNone
+)
+
+var gelfPool = newPool(512)
+
+// GELFFormat formats a log line as a GELF 1.1 message. The message is
+// written as the short message and the context as additional fields, their
+// keys prefixed with "_". The reserved "id" key is dropped.
+func GELFFormat(host string) Formatter {
+	return FormatterFunc(func(msg string, lvl Level, ctx []interface{}) []byte {
+		buf := gelfPool.Get()
+
+		formatGELF(buf, host, msg, lvl, ctx, time.Now())
+		buf.WriteByte('\n')
+
+		gelfPool.Put(buf)
+		return buf.Bytes()
+	})
+}
+
+// formatGELF formats a GELF message, adding it to the buffer.
+func formatGELF(buf *buffer, host, msg string, lvl Level, ctx []interface{}, now time.Time) {
+	buf.WriteString(`{"version":"1.1","host":`)
+	quoteGELFString(buf, host)
+	buf.WriteString(`,"short_message":`)
+	quoteGELFString(buf, msg)
+	buf.WriteString(`,"timestamp":`)
+	buf.AppendFloat(float64(now.UnixMilli())/1000, 'f', 3, 64)
+	buf.WriteString(`,"level":`)
+	buf.AppendInt(int64(syslogSeverity(lvl)))
+
+	for i := 0; i < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		if !ok {
+			writeGELFField(buf, errorKey, ctx[i])
+			continue
+		}
+
+		if err, ok := ctx[i+1].(error); ok {
+			writeGELFField(buf, k, errorMessage(err))
+			if causes := errorCauses(err); len(causes) > 0 {
+				writeGELFField(buf, k+CausesSuffix, strings.Join(causes, "; "))
+			}
+			continue
+		}
+
+		writeGELFField(buf, k, ctx[i+1])
+	}
+
+	buf.WriteByte('}')
+}
+
+// writeGELFField writes an additional field. Field names may only contain
+// letters, digits, underscores, dashes and dots, and values may only be
+// strings or numbers.
+func writeGELFField(buf *buffer, key string, value interface{}) {
+	if key == "id" || value == nil {
+		return
+	}
+
+	buf.WriteString(`,"_`)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '-', c == '.':
+		default:
+			c = '_'
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteString(`":`)
+
+	switch value.(type) {
+	case float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		formatJSONValue(buf, value)
+	default:
+		quoteGELFString(buf, formatPlainValue(value))
+	}
+}
+
+// quoteGELFString writes a JSON string. All control characters are escaped,
+// as a null byte terminates messages sent over TCP, and invalid UTF-8 is
+// replaced, as Graylog rejects it.
+func quoteGELFString(buf *buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(byte(r))
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[r>>4])
+			buf.WriteByte(hex[r&0xf])
+		case r < utf8.RuneSelf:
+			buf.WriteByte(byte(r))
+		default:
+			// Invalid UTF-8 is ranged over as utf8.RuneError, which is
+			// written as the replacement character
+			buf.WriteString(string(r))
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// GELFOption represents an option for the GELF handler.
+type GELFOption func(*gelfHandler)
+
+// GELFHost sets the host of messages. The default is the hostname reported
+// by the kernel.
+func GELFHost(host string) GELFOption {
+	return func(h *gelfHandler) {
+		h.host = host
+	}
+}
+
+// GELFCompression sets the compression of messages sent over UDP. The
+// default is CompressGzip. Messages sent over TCP are never compressed.
+func GELFCompression(c Compression) GELFOption {
+	return func(h *gelfHandler) {
+		h.compression = c
+	}
+}
+
+// GELFChunkSize sets the maximum size of a UDP datagram, including the
+// chunk header. The default is 1420.
+func GELFChunkSize(n int) GELFOption {
+	return func(h *gelfHandler) {
+		h.chunkSize = n
+	}
+}
+
+// GELFDialTimeout sets the maximum time to wait for a connection. The
+// default is 5 seconds.
+func GELFDialTimeout(d time.Duration) GELFOption {
+	return func(h *gelfHandler) {
+		h.dialTimeout = d
+	}
+}
+
+// GELFWriteTimeout sets the maximum time a write may take.
+func GELFWriteTimeout(d time.Duration) GELFOption {
+	return func(h *gelfHandler) {
+		h.conn.timeout = d
+	}
+}
+
+// GELFErrorHandler sets the function called when a write fails. By default
+// errors are reported to the package error handler.
+func GELFErrorHandler(fn func(error)) GELFOption {
+	return func(h *gelfHandler) {
+		h.onError = fn
+	}
+}
+
+type gelfHandler struct {
+	host        string
+	compression Compression
+	chunkSize   int
+	dialTimeout time.Duration
+	stream      bool
+	onError     func(error)
+
+	conn *netConn
+	w    *errWriter
+}
+
+// GELFHandler returns a handler that writes log messages to a Graylog
+// server in GELF. The network is either "udp", where messages are compressed
+// and split into chunks, or "tcp", where messages are terminated with a null
+// byte. The connection is made on the first message and reestablished with
+// backoff when it fails.
+func GELFHandler(network, addr string, opts ...GELFOption) (Handler, error) {
+	hostname, _ := os.Hostname()
+
+	h := &gelfHandler{
+		host:        hostname,
+		compression: CompressGzip,
+		chunkSize:   1420,
+		dialTimeout: 5 * time.Second,
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		h.stream = true
+	default:
+		return nil, fmt.Errorf("log: unsupported gelf network: %s", network)
+	}
+
+	h.conn = newNetConn(func() (net.Conn, error) {
+		return net.DialTimeout(network, addr, h.dialTimeout)
+	})
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.chunkSize <= gelfChunkHeaderSize {
+		return nil, fmt.Errorf("log: invalid gelf chunk size: %d", h.chunkSize)
+	}
+
+	h.w = &errWriter{w: h.conn, onError: h.onError}
+
+	return h, nil
+}
+
+// Log write the log message.
+func (h *gelfHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	h.TryLog(msg, lvl, ctx)
+}
+
+// TryLog writes the log message, returning an error if it could not be written.
+func (h *gelfHandler) TryLog(msg string, lvl Level, ctx []interface{}) error {
+	buf := gelfPool.Get()
+	defer gelfPool.Put(buf)
+
+	formatGELF(buf, h.host, msg, lvl, ctx, time.Now())
+
+	if h.stream {
+		buf.WriteByte(0)
+
+		_, err := h.w.Write(buf.Bytes())
+		return err
+	}
+
+	payload, err := h.compress(buf.Bytes())
+	if err != nil {
+		h.w.report(err)
+		return err
+	}
+
+	if len(payload) <= h.chunkSize {
+		_, err := h.w.Write(payload)
+		return err
+	}
+
+	return h.writeChunks(payload)
+}
+
+// compress compresses the message.
+func (h *gelfHandler) compress(p []byte) ([]byte, error) {
+	var b bytes.Buffer
+
+	var w io.WriteCloser
+	switch h.compression {
+	case CompressZlib:
+		w = zlib.NewWriter(&b)
+	case CompressNone:
+		return p, nil
+	default:
+		w = gzip.NewWriter(&b)
+	}
+
+	if _, err := w.Write(p); err != nil {
+		return nil, fmt.Errorf("log: could not compress gelf message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("log: could not compress gelf message: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeChunks splits the message into chunks, writing each as a datagram.
+func (h *gelfHandler) writeChunks(p []byte) error {
+	size := h.chunkSize - gelfChunkHeaderSize
+	count := (len(p) + size - 1) / size
+	if count > gelfMaxChunks {
+		err := fmt.Errorf("log: gelf message too large: %d bytes in %d chunks", len(p), count)
+		h.w.report(err)
+		return err
+	}
+
+	id := rand.Uint64()
+
+	chunk := make([]byte, 0, h.chunkSize)
+	for i := 0; i < count; i++ {
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		for j := 0; j < 8; j++ {
+			chunk = append(chunk, byte(id>>(56-8*j)))
+		}
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, p[i*size:min((i+1)*size, len(p))]...)
+
+		if _, err := h.w.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connection.
+func (h *gelfHandler) Close() error {
+	return h.conn.Close()
+}
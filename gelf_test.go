@@ -0,0 +1,262 @@
+package logged_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+// gelfUDPServer receives GELF datagrams, reassembling chunks and
+// decompressing messages.
+func gelfUDPServer(t *testing.T) (string, chan map[string]interface{}) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	ch := make(chan map[string]interface{}, 10)
+	go func() {
+		chunks := map[string][][]byte{}
+		b := make([]byte, 65536)
+		for {
+			n, _, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			data := append([]byte(nil), b[:n]...)
+
+			if len(data) > 2 && data[0] == 0x1e && data[1] == 0x0f {
+				id := string(data[2:10])
+				seq, count := int(data[10]), int(data[11])
+				if chunks[id] == nil {
+					chunks[id] = make([][]byte, count)
+				}
+				chunks[id][seq] = data[12:]
+
+				complete := true
+				for _, c := range chunks[id] {
+					if c == nil {
+						complete = false
+					}
+				}
+				if !complete {
+					continue
+				}
+				data = bytes.Join(chunks[id], nil)
+				delete(chunks, id)
+			}
+
+			ch <- decodeGELF(t, data)
+		}
+	}()
+
+	return pc.LocalAddr().String(), ch
+}
+
+func decodeGELF(t *testing.T, data []byte) map[string]interface{} {
+	var r io.Reader = bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(r)
+		assert.NoError(t, err)
+		r = gz
+	case data[0] == 0x78:
+		zr, err := zlib.NewReader(r)
+		assert.NoError(t, err)
+		r = zr
+	}
+
+	var m map[string]interface{}
+	assert.NoError(t, json.NewDecoder(r).Decode(&m))
+
+	return m
+}
+
+func receiveGELF(t *testing.T, ch chan map[string]interface{}) map[string]interface{} {
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+func TestGELFFormat(t *testing.T) {
+	f := logged.GELFFormat("host")
+
+	b := f.Format("some message", logged.Warn, []interface{}{"foo", "bar", "n", 2, "ok", true, "id", 1, "a b", "c", 3, "x"})
+
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.InDelta(t, float64(time.Now().Unix()), m["timestamp"], 5)
+	delete(m, "timestamp")
+	assert.Equal(t, map[string]interface{}{
+		"version":       "1.1",
+		"host":          "host",
+		"short_message": "some message",
+		"level":         4.0,
+		"_foo":          "bar",
+		"_n":            2.0,
+		"_ok":           "true",
+		"_a_b":          "c",
+		"_LOGGED_ERROR": 3.0,
+	}, m)
+}
+
+func TestGELFFormat_Escaping(t *testing.T) {
+	f := logged.GELFFormat("host")
+
+	b := f.Format("café\x00\x1f", logged.Info, []interface{}{"v", "a\x00b", "bad", "\xe9"})
+
+	assert.True(t, utf8.Valid(b))
+	assert.NotContains(t, string(b), "\x00")
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "café\x00\x1f", m["short_message"])
+	assert.Equal(t, "a\x00b", m["_v"])
+	assert.Equal(t, "\ufffd", m["_bad"])
+}
+
+func TestGELFHandler_UDP(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression logged.Compression
+	}{
+		{"Gzip", logged.CompressGzip},
+		{"Zlib", logged.CompressZlib},
+		{"None", logged.CompressNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, ch := gelfUDPServer(t)
+			h, err := logged.GELFHandler("udp", addr, logged.GELFHost("host"), logged.GELFCompression(tt.compression))
+			assert.NoError(t, err)
+			defer h.(io.Closer).Close()
+
+			err = h.(logged.FallibleHandler).TryLog("some message", logged.Error, []interface{}{"err", errors.Join(errors.New("a"), errors.New("b"))})
+
+			assert.NoError(t, err)
+			m := receiveGELF(t, ch)
+			assert.Equal(t, "host", m["host"])
+			assert.Equal(t, "some message", m["short_message"])
+			assert.Equal(t, 3.0, m["level"])
+			assert.Equal(t, "a\nb", m["_err"])
+			assert.Equal(t, "a; b", m["_err.causes"])
+		})
+	}
+}
+
+func TestGELFHandler_UDPChunking(t *testing.T) {
+	addr, ch := gelfUDPServer(t)
+	h, err := logged.GELFHandler("udp", addr, logged.GELFChunkSize(512))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	// Random data does not compress, so it needs several chunks
+	b := make([]byte, 4096)
+	rand.Read(b)
+	msg := hex.EncodeToString(b)
+
+	err = h.(logged.FallibleHandler).TryLog(msg, logged.Info, []interface{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, msg, receiveGELF(t, ch)["short_message"])
+}
+
+func TestGELFHandler_UDPTooManyChunks(t *testing.T) {
+	addr, _ := gelfUDPServer(t)
+	var errs []error
+	h, err := logged.GELFHandler("udp", addr,
+		logged.GELFChunkSize(64),
+		logged.GELFCompression(logged.CompressNone),
+		logged.GELFErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	err = h.(logged.FallibleHandler).TryLog(string(make([]byte, 64*128)), logged.Info, []interface{}{})
+
+	assert.Error(t, err)
+	assert.Len(t, errs, 1)
+}
+
+func TestGELFHandler_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	h, err := logged.GELFHandler("tcp", ln.Addr().String(), logged.GELFHost("host"))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("first", logged.Info, []interface{}{})
+	h.Log("second", logged.Debug, []interface{}{"foo", "bar"})
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	b, err := r.ReadBytes(0)
+	assert.NoError(t, err)
+	m := decodeGELF(t, b[:len(b)-1])
+	assert.Equal(t, "first", m["short_message"])
+	assert.Equal(t, 6.0, m["level"])
+
+	b, err = r.ReadBytes(0)
+	assert.NoError(t, err)
+	m = decodeGELF(t, b[:len(b)-1])
+	assert.Equal(t, "second", m["short_message"])
+	assert.Equal(t, 7.0, m["level"])
+	assert.Equal(t, "bar", m["_foo"])
+}
+
+func TestGELFHandler_TCPNullBytes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	h, err := logged.GELFHandler("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("a\x00b", logged.Info, []interface{}{"v", "c\x00d"})
+	h.Log("second", logged.Info, []interface{}{})
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	b, err := r.ReadBytes(0)
+	assert.NoError(t, err)
+	m := decodeGELF(t, b[:len(b)-1])
+	assert.Equal(t, "a\x00b", m["short_message"])
+	assert.Equal(t, "c\x00d", m["_v"])
+
+	b, err = r.ReadBytes(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", decodeGELF(t, b[:len(b)-1])["short_message"])
+}
+
+func TestGELFHandler_InvalidOptions(t *testing.T) {
+	_, err := logged.GELFHandler("unix", "/tmp/gelf.sock")
+	assert.Error(t, err)
+
+	_, err = logged.GELFHandler("udp", "127.0.0.1:12201", logged.GELFChunkSize(12))
+	assert.Error(t, err)
+}
@@ -1,8 +1,11 @@
 package logged
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,6 +15,35 @@ type Handler interface {
 	Log(msg string, lvl Level, ctx []interface{})
 }
 
+// FallibleHandler represents a handler that can report whether a message
+// was written.
+type FallibleHandler interface {
+	Handler
+
+	// TryLog writes the log message, returning an error if it could not be written.
+	TryLog(msg string, lvl Level, ctx []interface{}) error
+}
+
+// Enabler represents a handler that can report whether it writes messages
+// of a level, allowing the work of logging them to be skipped.
+type Enabler interface {
+	// Enabled returns true if messages of the level would be written.
+	Enabled(lvl Level) bool
+}
+
+// Shutdowner represents a handler that can be shut down within a deadline.
+type Shutdowner interface {
+	// Shutdown closes the handler, waiting for buffered messages to be
+	// written until the context is done.
+	Shutdown(ctx context.Context) error
+}
+
+// Flusher represents a handler that can flush buffered messages.
+type Flusher interface {
+	// Flush waits until all buffered messages have been written.
+	Flush() error
+}
+
 // HandlerFunc is a function handler.
 type HandlerFunc func(msg string, lvl Level, ctx []interface{})
 
@@ -20,35 +52,154 @@ func (h HandlerFunc) Log(msg string, lvl Level, ctx []interface{}) {
 	h(msg, lvl, ctx)
 }
 
+// BufferedStats contains the statistics of a buffered stream handler.
+type BufferedStats struct {
+	// QueuedBytes is the number of bytes waiting to be written.
+	QueuedBytes uint64
+	// DroppedBytes is the number of bytes dropped due to a full queue.
+	DroppedBytes uint64
+	// WrittenBytes is the number of bytes written.
+	WrittenBytes uint64
+	// FailedWrites is the number of writes that failed.
+	FailedWrites uint64
+}
+
+// BufferedOption represents an option for the buffered stream handler.
+type BufferedOption func(*bufStreamHandler)
+
+// BufferedQueueSize sets the number of full buffers that can wait to be written.
+func BufferedQueueSize(n int) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.queueSize = n
+	}
+}
+
+// BufferedOverflow sets the policy used for full buffers when the queue is
+// full. OverflowDropNewest drops the full buffer, OverflowDropOldest drops the
+// oldest queued buffer, and all other policies wait for space in the queue.
+func BufferedOverflow(policy OverflowPolicy) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.policy = policy
+	}
+}
+
+// BufferedSpill sets a writer that full buffers are written to when the
+// queue is full, instead of applying the overflow policy.
+func BufferedSpill(w io.Writer) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.spill = w
+	}
+}
+
+// BufferedWriteTimeout sets the maximum time to wait for space in the queue
+// before the full buffer is dropped or spilled. If the writer has a
+// SetWriteDeadline method, it is also used as the deadline of each write.
+func BufferedWriteTimeout(d time.Duration) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.writeTimeout = d
+	}
+}
+
+// BufferedFlushLevel sets the level at or above which a message causes the
+// buffer to be flushed immediately.
+func BufferedFlushLevel(lvl Level) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.flushOnLevel = true
+		h.flushLevel = lvl
+	}
+}
+
+// BufferedFlushWait makes messages flushed due to their level wait until
+// they have been written before Log returns.
+func BufferedFlushWait() BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.flushWait = true
+	}
+}
+
+// BufferedErrorHandler sets the function called when a write fails. By default
+// the package error handler is used.
+func BufferedErrorHandler(fn func(error)) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.w.onError = fn
+	}
+}
+
+// BufferedFallback sets a writer that buffers are written to when writing
+// to the writer fails.
+func BufferedFallback(w io.Writer) BufferedOption {
+	return func(h *bufStreamHandler) {
+		h.w.fallback = w
+	}
+}
+
+type queuedBuffer struct {
+	buf *buffer
+	seq uint64
+}
+
 type bufStreamHandler struct {
 	flushBytes    int
 	flushInterval time.Duration
-	w             io.Writer
+	w             *errWriter
 	fmtr          Formatter
+	queueSize     int
+	policy        OverflowPolicy
+	spill         io.Writer
+	writeTimeout  time.Duration
+	flushOnLevel  bool
+	flushLevel    Level
+	flushWait     bool
 
 	mx   sync.Mutex
 	pool pool
 	buf  *buffer
-	ch   chan *buffer
+	ch   chan queuedBuffer
+	seq  uint64
+	last uint64
 
-	shutdown chan bool
+	doneMx   sync.Mutex
+	doneCond *sync.Cond
+	doneSeq  uint64
+	closed   bool
+
+	queued  atomic.Uint64
+	dropped atomic.Uint64
+	written atomic.Uint64
+
+	once     sync.Once
+	shutdown chan struct{}
 }
 
 // BufferedStreamHandler writes buffered log messages to an io.Writer with the given format.
-func BufferedStreamHandler(w io.Writer, flushBytes int, flushInterval time.Duration, fmtr Formatter) Handler {
+//
+// BufferedStreamHandler panics if the queue size is negative.
+func BufferedStreamHandler(w io.Writer, flushBytes int, flushInterval time.Duration, fmtr Formatter, opts ...BufferedOption) Handler {
 	pool := newPool(flushBytes)
 
 	h := &bufStreamHandler{
 		flushBytes:    flushBytes,
 		flushInterval: flushInterval,
 		fmtr:          fmtr,
-		w:             w,
+		w:             &errWriter{w: w},
+		queueSize:     32,
+		policy:        OverflowBlock,
 		pool:          pool,
 		buf:           pool.Get(),
-		ch:            make(chan *buffer, 32),
-		shutdown:      make(chan bool, 1),
+		shutdown:      make(chan struct{}),
 	}
 
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.queueSize < 0 {
+		panic(fmt.Sprintf("log: invalid buffered queue size: %d", h.queueSize))
+	}
+
+	h.ch = make(chan queuedBuffer, h.queueSize)
+	h.doneCond = sync.NewCond(&h.doneMx)
+
 	go h.run()
 
 	return h
@@ -58,9 +209,9 @@ func (h *bufStreamHandler) run() {
 	doneChan := make(chan bool)
 
 	go func() {
-		for buf := range h.ch {
-			h.w.Write(buf.Bytes())
-			h.pool.Put(buf)
+		for qb := range h.ch {
+			h.write(qb.buf)
+			h.markDone(qb.seq)
 		}
 		doneChan <- true
 	}()
@@ -76,14 +227,55 @@ func (h *bufStreamHandler) run() {
 			})
 
 		case <-doneChan:
-			h.shutdown <- true
+			close(h.shutdown)
 			return
 		}
 	}
 }
 
+// write writes a queued buffer to the writer.
+func (h *bufStreamHandler) write(buf *buffer) {
+	if dw, ok := h.w.w.(interface{ SetWriteDeadline(time.Time) error }); ok && h.writeTimeout > 0 {
+		dw.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+	}
+
+	n, _ := h.w.Write(buf.Bytes())
+	h.written.Add(uint64(n))
+	h.queued.Add(^uint64(buf.Len() - 1))
+	h.pool.Put(buf)
+}
+
+// markDone marks all queued buffers up to seq as written.
+func (h *bufStreamHandler) markDone(seq uint64) {
+	h.doneMx.Lock()
+	h.doneSeq = seq
+	h.doneMx.Unlock()
+
+	h.doneCond.Broadcast()
+}
+
+// markClosed stops all waits for queued buffers, which are left to Shutdown.
+func (h *bufStreamHandler) markClosed() {
+	h.doneMx.Lock()
+	h.closed = true
+	h.doneMx.Unlock()
+
+	h.doneCond.Broadcast()
+}
+
+// waitDone waits until all queued buffers up to seq have been written, or
+// the handler has been closed.
+func (h *bufStreamHandler) waitDone(seq uint64) {
+	h.doneMx.Lock()
+	for h.doneSeq < seq && !h.closed {
+		h.doneCond.Wait()
+	}
+	h.doneMx.Unlock()
+}
+
 // Log write the log message.
 func (h *bufStreamHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	var seq uint64
 	h.withBufferLock(func() {
 		// Dont write to a closed
 		if h.buf == nil {
@@ -92,25 +284,88 @@ func (h *bufStreamHandler) Log(msg string, lvl Level, ctx []interface{}) {
 
 		h.buf.Write(h.fmtr.Format(msg, lvl, ctx))
 
-		if h.buf.Len() >= h.flushBytes {
+		severe := h.flushOnLevel && lvl <= h.flushLevel
+		if h.buf.Len() >= h.flushBytes || severe {
 			h.swap()
 		}
+
+		if severe && h.flushWait {
+			seq = h.last
+		}
 	})
+
+	if seq > 0 {
+		h.waitDone(seq)
+	}
 }
 
-// Close closes the handler, waiting for all buffers to be flushed.
-func (h *bufStreamHandler) Close() error {
+// Flush waits until all messages logged before the call have been written.
+// Once the handler is closed, it returns immediately.
+func (h *bufStreamHandler) Flush() error {
+	var seq uint64
 	h.withBufferLock(func() {
 		h.swap()
-		h.buf = nil
+		seq = h.last
 	})
 
-	close(h.ch)
-	<-h.shutdown
+	h.waitDone(seq)
 
 	return nil
 }
 
+// Stats returns the statistics of the handler.
+func (h *bufStreamHandler) Stats() BufferedStats {
+	return BufferedStats{
+		QueuedBytes:  h.queued.Load(),
+		DroppedBytes: h.dropped.Load(),
+		WrittenBytes: h.written.Load(),
+		FailedWrites: h.w.failed.Load(),
+	}
+}
+
+// Close closes the handler, waiting for all buffers to be flushed.
+func (h *bufStreamHandler) Close() error {
+	return h.Shutdown(context.Background())
+}
+
+// Shutdown closes the handler, waiting for all buffers to be flushed until
+// the context is done. The number of bytes left unwritten is reported
+// in the error.
+func (h *bufStreamHandler) Shutdown(ctx context.Context) error {
+	h.once.Do(func() {
+		var qb queuedBuffer
+		h.withBufferLock(func() {
+			if h.buf.Len() > 0 {
+				h.seq++
+				qb = queuedBuffer{buf: h.buf, seq: h.seq}
+				h.queued.Add(uint64(h.buf.Len()))
+			}
+			h.buf = nil
+		})
+		h.markClosed()
+
+		if qb.buf != nil {
+			select {
+			case h.ch <- qb:
+				// The last buffer is only waited for once it is queued
+				h.withBufferLock(func() {
+					h.last = qb.seq
+				})
+			case <-ctx.Done():
+			}
+		}
+
+		close(h.ch)
+	})
+
+	select {
+	case <-h.shutdown:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("log: shutdown abandoned %d bytes: %w", h.queued.Load(), ctx.Err())
+	}
+}
+
 func (h *bufStreamHandler) withBufferLock(fn func()) {
 	h.mx.Lock()
 	fn()
@@ -124,20 +379,137 @@ func (h *bufStreamHandler) swap() {
 
 	old := h.buf
 	h.buf = h.pool.Get()
-	h.ch <- old
+	h.enqueue(old)
+}
+
+// enqueue queues a full buffer to be written, applying the overflow policy
+// if the queue is full. It must be called with the buffer lock held.
+func (h *bufStreamHandler) enqueue(buf *buffer) {
+	n := uint64(buf.Len())
+	h.queued.Add(n)
+	h.seq++
+	qb := queuedBuffer{buf: buf, seq: h.seq}
+
+	select {
+	case h.ch <- qb:
+		h.last = qb.seq
+		return
+	default:
+	}
+
+	switch {
+	case h.spill != nil:
+
+	case h.policy.mode == overflowDropNewest:
+
+	case h.policy.mode == overflowDropOldest:
+		select {
+		case old := <-h.ch:
+			h.queued.Add(^uint64(old.buf.Len() - 1))
+			h.dropped.Add(uint64(old.buf.Len()))
+			h.pool.Put(old.buf)
+		default:
+		}
+
+		select {
+		case h.ch <- qb:
+			h.last = qb.seq
+			return
+		default:
+		}
+
+	default:
+		if h.writeTimeout <= 0 {
+			h.ch <- qb
+			h.last = qb.seq
+			return
+		}
+
+		timer := time.NewTimer(h.writeTimeout)
+		defer timer.Stop()
+
+		select {
+		case h.ch <- qb:
+			h.last = qb.seq
+			return
+		case <-timer.C:
+		}
+	}
+
+	h.queued.Add(^uint64(n - 1))
+	if h.spill != nil {
+		m, _ := writeFull(h.spill, buf.Bytes())
+		h.written.Add(uint64(m))
+	} else {
+		h.dropped.Add(n)
+	}
+	h.pool.Put(buf)
+}
+
+// StreamStats contains the statistics of a stream handler.
+type StreamStats struct {
+	// FailedWrites is the number of writes that failed.
+	FailedWrites uint64
+}
+
+// StreamOption represents an option for the stream handler.
+type StreamOption func(*streamHandler)
+
+// StreamErrorHandler sets the function called when a write fails. By default
+// the package error handler is used.
+func StreamErrorHandler(fn func(error)) StreamOption {
+	return func(h *streamHandler) {
+		h.w.onError = fn
+	}
+}
+
+// StreamFallback sets a writer that messages are written to when writing
+// to the writer fails.
+func StreamFallback(w io.Writer) StreamOption {
+	return func(h *streamHandler) {
+		h.w.fallback = w
+	}
+}
+
+type streamHandler struct {
+	mu   sync.Mutex
+	w    *errWriter
+	fmtr Formatter
 }
 
 // StreamHandler writes log messages to an io.Writer with the given format.
-func StreamHandler(w io.Writer, fmtr Formatter) Handler {
-	var mu sync.Mutex
+func StreamHandler(w io.Writer, fmtr Formatter, opts ...StreamOption) Handler {
+	h := &streamHandler{
+		w:    &errWriter{w: w},
+		fmtr: fmtr,
+	}
 
-	h := func(msg string, lvl Level, ctx []interface{}) {
-		mu.Lock()
-		w.Write(fmtr.Format(msg, lvl, ctx))
-		mu.Unlock()
+	for _, opt := range opts {
+		opt(h)
 	}
 
-	return HandlerFunc(h)
+	return h
+}
+
+// Log write the log message.
+func (h *streamHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	h.TryLog(msg, lvl, ctx)
+}
+
+// TryLog writes the log message, returning an error if it could not be written.
+func (h *streamHandler) TryLog(msg string, lvl Level, ctx []interface{}) error {
+	h.mu.Lock()
+	_, err := h.w.Write(h.fmtr.Format(msg, lvl, ctx))
+	h.mu.Unlock()
+
+	return err
+}
+
+// Stats returns the statistics of the handler.
+func (h *streamHandler) Stats() StreamStats {
+	return StreamStats{
+		FailedWrites: h.w.failed.Load(),
+	}
 }
 
 // FilterFunc represents a function that can filter messages.
@@ -146,43 +518,152 @@ type FilterFunc func(msg string, lvl Level, ctx []interface{}) bool
 // FilterHandler returns a handler that only writes messages to the wrapped
 // handler if the given function evaluates true.
 func FilterHandler(fn FilterFunc, h Handler) Handler {
-	c := &closeHandler{
-		Handler: HandlerFunc(func(msg string, lvl Level, ctx []interface{}) {
-			if fn(msg, lvl, ctx) {
-				h.Log(msg, lvl, ctx)
-			}
-		}),
-	}
+	return wrapHandler(func(msg string, lvl Level, ctx []interface{}) (string, []interface{}, bool) {
+		return msg, ctx, fn(msg, lvl, ctx)
+	}, h)
+}
 
-	if ch, ok := h.(io.Closer); ok {
-		c.Closer = ch
-	}
+type levelFilterHandler struct {
+	*closeHandler
 
-	return c
+	maxLvl Level
 }
 
-// LevelFilterHandler returns a handler that
+// LevelFilterHandler returns a handler that only writes messages at or above
+// the given level to the wrapped handler.
 func LevelFilterHandler(maxLvl Level, h Handler) Handler {
-	return FilterHandler(func(msg string, lvl Level, ctx []interface{}) bool {
-		return lvl <= maxLvl
-	}, h)
+	return &levelFilterHandler{
+		closeHandler: &closeHandler{
+			fn: func(msg string, lvl Level, ctx []interface{}) (string, []interface{}, bool) {
+				return msg, ctx, lvl <= maxLvl
+			},
+			h: h,
+		},
+		maxLvl: maxLvl,
+	}
+}
+
+// Enabled returns true if messages of the level would be written.
+func (h *levelFilterHandler) Enabled(lvl Level) bool {
+	return lvl <= h.maxLvl && h.closeHandler.Enabled(lvl)
 }
 
+type discardHandler struct{}
+
 // DiscardHandler does nothing, discarding all log messages.
 func DiscardHandler() Handler {
-	return HandlerFunc(func(msg string, lvl Level, ctx []interface{}) {})
+	return discardHandler{}
+}
+
+// Log write the log message.
+func (discardHandler) Log(msg string, lvl Level, ctx []interface{}) {}
+
+// Enabled returns false, as no messages are written.
+func (discardHandler) Enabled(lvl Level) bool {
+	return false
+}
+
+// tryLog writes the log message, returning an error if the handler
+// implements FallibleHandler and could not write it.
+func tryLog(h Handler, msg string, lvl Level, ctx []interface{}) error {
+	if fh, ok := h.(FallibleHandler); ok {
+		return fh.TryLog(msg, lvl, ctx)
+	}
+
+	h.Log(msg, lvl, ctx)
+	return nil
+}
+
+// enabled returns true if the handler writes messages of the level. Handlers
+// that do not implement Enabler are assumed to write all levels.
+func enabled(h Handler, lvl Level) bool {
+	if eh, ok := h.(Enabler); ok {
+		return eh.Enabled(lvl)
+	}
+
+	return true
+}
+
+// tryClose closes the handler if it implements io.Closer.
+func tryClose(h Handler) error {
+	if ch, ok := h.(io.Closer); ok {
+		return ch.Close()
+	}
+
+	return nil
+}
+
+// tryShutdown shuts down the handler if it implements Shutdowner, otherwise
+// closing it if it implements io.Closer.
+func tryShutdown(ctx context.Context, h Handler) error {
+	if sh, ok := h.(Shutdowner); ok {
+		return sh.Shutdown(ctx)
+	}
+
+	return tryClose(h)
+}
+
+// tryFlush flushes the handler if it implements Flusher.
+func tryFlush(h Handler) error {
+	if fh, ok := h.(Flusher); ok {
+		return fh.Flush()
+	}
+
+	return nil
 }
 
-// closeHandler wraps a handler allowing it to close if it has a Close method.
+// wrapFunc prepares a message for the wrapped handler, returning false if
+// it should not be written.
+type wrapFunc func(msg string, lvl Level, ctx []interface{}) (string, []interface{}, bool)
+
+// closeHandler wraps a handler allowing it to close, shut down, flush,
+// report enabled levels and report failed writes if the wrapped handler
+// supports them.
 type closeHandler struct {
-	io.Closer
-	Handler
+	fn wrapFunc
+
+	h Handler
 }
 
-func (h *closeHandler) Close() error {
-	if h.Closer != nil {
-		return h.Closer.Close()
+// wrapHandler returns a handler that writes messages prepared by fn to the
+// wrapped handler h, and closes, shuts down and flushes h.
+func wrapHandler(fn wrapFunc, h Handler) Handler {
+	return &closeHandler{fn: fn, h: h}
+}
+
+// Log write the log message.
+func (h *closeHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	if msg, ctx, ok := h.fn(msg, lvl, ctx); ok {
+		h.h.Log(msg, lvl, ctx)
+	}
+}
+
+// TryLog writes the log message, returning an error if the wrapped handler
+// could not write it.
+func (h *closeHandler) TryLog(msg string, lvl Level, ctx []interface{}) error {
+	if msg, ctx, ok := h.fn(msg, lvl, ctx); ok {
+		return tryLog(h.h, msg, lvl, ctx)
 	}
 
 	return nil
 }
+
+// Close closes the wrapped handler.
+func (h *closeHandler) Close() error {
+	return tryClose(h.h)
+}
+
+// Enabled returns true if the wrapped handler writes messages of the level.
+func (h *closeHandler) Enabled(lvl Level) bool {
+	return enabled(h.h, lvl)
+}
+
+// Shutdown shuts down the wrapped handler.
+func (h *closeHandler) Shutdown(ctx context.Context) error {
+	return tryShutdown(ctx, h.h)
+}
+
+// Flush flushes the wrapped handler.
+func (h *closeHandler) Flush() error {
+	return tryFlush(h.h)
+}
@@ -2,7 +2,10 @@ package logged_test
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -55,6 +58,88 @@ func TestBufferedStreamHandler_DoesntWriteAfterClose(t *testing.T) {
 	assert.Equal(t, "", buf.String())
 }
 
+func TestBufferedStreamHandler_Flush(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	close(w.release)
+	h := logged.BufferedStreamHandler(w, 2000, time.Minute, logged.LogfmtFormat())
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Error, []interface{}{})
+	err := h.(logged.Flusher).Flush()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=eror msg=\"some message\"\n", w.String())
+}
+
+func TestBufferedStreamHandler_FlushLevel(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	close(w.release)
+	h := logged.BufferedStreamHandler(w, 2000, time.Minute, logged.LogfmtFormat(), logged.BufferedFlushLevel(logged.Error), logged.BufferedFlushWait())
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	assert.Equal(t, "", w.String())
+
+	h.Log("some message", logged.Crit, []interface{}{})
+
+	assert.Equal(t, "lvl=info msg=\"some message\"\nlvl=crit msg=\"some message\"\n", w.String())
+}
+
+func TestBufferedStreamHandler_CloseIsIdempotent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := logged.BufferedStreamHandler(buf, 2000, time.Second, logged.LogfmtFormat())
+
+	h.Log("some message", logged.Error, []interface{}{})
+
+	assert.NoError(t, h.(io.Closer).Close())
+	assert.NoError(t, h.(io.Closer).Close())
+	assert.Equal(t, "lvl=eror msg=\"some message\"\n", buf.String())
+}
+
+func TestBufferedStreamHandler_Shutdown(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	h := logged.BufferedStreamHandler(w, 2000, time.Second, logged.LogfmtFormat())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	h.Log("some message", logged.Error, []interface{}{})
+	err := h.(logged.Shutdowner).Shutdown(ctx)
+
+	assert.EqualError(t, err, "log: shutdown abandoned 28 bytes: context deadline exceeded")
+
+	close(w.release)
+	err = h.(logged.Shutdowner).Shutdown(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=eror msg=\"some message\"\n", w.String())
+}
+
+func TestBufferedStreamHandler_FlushAfterAbandonedShutdown(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	defer close(w.release)
+	h := logged.BufferedStreamHandler(w, 2000, time.Second, logged.LogfmtFormat())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	h.Log("some message", logged.Error, []interface{}{})
+	err := h.(logged.Shutdowner).Shutdown(ctx)
+	assert.Error(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		h.(logged.Flusher).Flush()
+		logged.New(h).Sync()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("flush did not return after abandoned shutdown")
+	}
+}
+
 func TestStreamHandler(t *testing.T) {
 	buf := &bytes.Buffer{}
 	h := logged.StreamHandler(buf, logged.LogfmtFormat())
@@ -95,8 +180,167 @@ func TestLevelFilterHandler_CallsUnderlyingClose(t *testing.T) {
 	assert.True(t, testHandler.CloseCalled)
 }
 
+func TestLevelFilterHandler_CallsUnderlyingFlush(t *testing.T) {
+	testHandler := &FlushableHandler{}
+	h := logged.LevelFilterHandler(logged.Info, testHandler)
+
+	err := h.(logged.Flusher).Flush()
+
+	assert.NoError(t, err)
+	assert.True(t, testHandler.FlushCalled)
+}
+
+func TestLevelFilterHandler_CallsUnderlyingShutdown(t *testing.T) {
+	testHandler := &CloseableHandler{}
+	h := logged.LevelFilterHandler(logged.Info, testHandler)
+
+	err := h.(logged.Shutdowner).Shutdown(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, testHandler.CloseCalled)
+}
+
+func TestLevelFilterHandler_Enabled(t *testing.T) {
+	h := logged.LevelFilterHandler(logged.Info, &RecordingHandler{})
+
+	assert.True(t, h.(logged.Enabler).Enabled(logged.Info))
+	assert.False(t, h.(logged.Enabler).Enabled(logged.Debug))
+
+	h = logged.LevelFilterHandler(logged.Info, logged.LevelFilterHandler(logged.Error, &RecordingHandler{}))
+
+	assert.False(t, h.(logged.Enabler).Enabled(logged.Warn))
+}
+
 func TestDiscardHandler(t *testing.T) {
 	h := logged.DiscardHandler()
 
 	h.Log("test", logged.Crit, []interface{}{})
+
+	assert.False(t, h.(logged.Enabler).Enabled(logged.Crit))
+}
+
+type stalledWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	<-w.release
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func (w *stalledWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.String()
+}
+
+func TestBufferedStreamHandler_StalledWriterBlocks(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	h := logged.BufferedStreamHandler(w, 1, time.Second, logged.LogfmtFormat(), logged.BufferedQueueSize(1))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			h.Log("some message", logged.Error, []interface{}{})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Expected logging to block on a stalled writer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(w.release)
+	<-done
+	h.(io.Closer).Close()
+
+	assert.Equal(t, strings.Repeat("lvl=eror msg=\"some message\"\n", 3), w.String())
+}
+
+func TestBufferedStreamHandler_Overflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []logged.BufferedOption
+		written uint64
+		dropped uint64
+	}{
+		{
+			name:    "DropNewest",
+			opts:    []logged.BufferedOption{logged.BufferedOverflow(logged.OverflowDropNewest)},
+			written: 56,
+			dropped: 84,
+		},
+		{
+			name:    "DropOldest",
+			opts:    []logged.BufferedOption{logged.BufferedOverflow(logged.OverflowDropOldest)},
+			written: 56,
+			dropped: 84,
+		},
+		{
+			name:    "WriteTimeout",
+			opts:    []logged.BufferedOption{logged.BufferedWriteTimeout(time.Millisecond)},
+			written: 56,
+			dropped: 84,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &stalledWriter{release: make(chan struct{})}
+			opts := append([]logged.BufferedOption{logged.BufferedQueueSize(1)}, tt.opts...)
+			h := logged.BufferedStreamHandler(w, 1, time.Second, logged.LogfmtFormat(), opts...)
+
+			h.Log("some message", logged.Error, []interface{}{})
+			// Wait for the writer to pick up the first buffer
+			time.Sleep(5 * time.Millisecond)
+			for i := 0; i < 4; i++ {
+				h.Log("some message", logged.Error, []interface{}{})
+			}
+
+			stats := h.(interface{ Stats() logged.BufferedStats }).Stats()
+			assert.Equal(t, uint64(56), stats.QueuedBytes)
+			assert.Equal(t, tt.dropped, stats.DroppedBytes)
+
+			close(w.release)
+			h.(io.Closer).Close()
+
+			stats = h.(interface{ Stats() logged.BufferedStats }).Stats()
+			assert.Equal(t, uint64(0), stats.QueuedBytes)
+			assert.Equal(t, tt.written, stats.WrittenBytes)
+			assert.Equal(t, tt.written, uint64(len(w.String())))
+		})
+	}
+}
+
+func TestBufferedStreamHandler_InvalidQueueSize(t *testing.T) {
+	assert.PanicsWithValue(t, "log: invalid buffered queue size: -1", func() {
+		logged.BufferedStreamHandler(&bytes.Buffer{}, 2000, time.Second, logged.LogfmtFormat(), logged.BufferedQueueSize(-1))
+	})
+}
+
+func TestBufferedStreamHandler_Spill(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	spill := &bytes.Buffer{}
+	h := logged.BufferedStreamHandler(w, 1, time.Second, logged.LogfmtFormat(), logged.BufferedQueueSize(1), logged.BufferedSpill(spill))
+
+	h.Log("some message", logged.Error, []interface{}{})
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		h.Log("some message", logged.Error, []interface{}{})
+	}
+
+	close(w.release)
+	h.(io.Closer).Close()
+
+	assert.Equal(t, strings.Repeat("lvl=eror msg=\"some message\"\n", 3), spill.String())
+	assert.Equal(t, uint64(0), h.(interface{ Stats() logged.BufferedStats }).Stats().DroppedBytes)
 }
@@ -0,0 +1,227 @@
+package logged
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// JournaldOption represents an option for the journald handler.
+type JournaldOption func(*journaldHandler)
+
+// JournaldSocket sets the path of the journald socket. The default is
+// "/run/systemd/journal/socket".
+func JournaldSocket(path string) JournaldOption {
+	return func(h *journaldHandler) {
+		h.w.addr = &net.UnixAddr{Name: path, Net: "unixgram"}
+	}
+}
+
+// JournaldIdentifier sets the SYSLOG_IDENTIFIER field of messages. The
+// default is the name of the program.
+func JournaldIdentifier(id string) JournaldOption {
+	return func(h *journaldHandler) {
+		h.identifier = id
+	}
+}
+
+// JournaldErrorHandler sets the function called when a write fails. By default
+// errors are reported to the package error handler.
+func JournaldErrorHandler(fn func(error)) JournaldOption {
+	return func(h *journaldHandler) {
+		h.ew.onError = fn
+	}
+}
+
+var journaldPool = newPool(512)
+
+type journaldHandler struct {
+	identifier string
+
+	w  *journalWriter
+	ew *errWriter
+
+	once     sync.Once
+	closeErr error
+}
+
+// JournaldHandler returns a handler that writes log messages to journald
+// using its native protocol. Each context pair is written as a field, its
+// key converted to uppercase with unsupported characters replaced by "_",
+// so it can be queried with journalctl. A caller in the CallerKey is written
+// as the CODE_FILE and CODE_LINE fields.
+//
+// Entries too large for a datagram are passed to journald in a temporary
+// file, which is only supported on Linux.
+func JournaldHandler(opts ...JournaldOption) (Handler, error) {
+	h := &journaldHandler{
+		identifier: filepath.Base(os.Args[0]),
+		w: &journalWriter{
+			addr: &net.UnixAddr{Name: "/run/systemd/journal/socket", Net: "unixgram"},
+		},
+	}
+	h.ew = &errWriter{w: h.w}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("log: could not create journald socket: %w", err)
+	}
+	h.w.conn = conn
+
+	return h, nil
+}
+
+// Log write the log message.
+func (h *journaldHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	h.TryLog(msg, lvl, ctx)
+}
+
+// TryLog writes the log message, returning an error if it could not be written.
+func (h *journaldHandler) TryLog(msg string, lvl Level, ctx []interface{}) error {
+	buf := journaldPool.Get()
+	defer journaldPool.Put(buf)
+
+	writeJournalField(buf, "MESSAGE", msg)
+	writeJournalField(buf, "PRIORITY", strconv.Itoa(syslogSeverity(lvl)))
+	if h.identifier != "" {
+		writeJournalField(buf, "SYSLOG_IDENTIFIER", h.identifier)
+	}
+
+	for i := 0; i < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		if !ok {
+			writeJournalField(buf, errorKey, formatPlainValue(ctx[i]))
+			continue
+		}
+
+		name := journalFieldName(k)
+
+		if err, ok := ctx[i+1].(error); ok {
+			writeJournalField(buf, name, errorMessage(err))
+			if causes := errorCauses(err); len(causes) > 0 {
+				writeJournalField(buf, journalFieldName(k+CausesSuffix), strings.Join(causes, "; "))
+			}
+			continue
+		}
+
+		if k == CallerKey {
+			if file, line, ok := splitCaller(ctx[i+1]); ok {
+				writeJournalField(buf, "CODE_FILE", file)
+				writeJournalField(buf, "CODE_LINE", line)
+				continue
+			}
+		}
+
+		writeJournalField(buf, name, formatPlainValue(ctx[i+1]))
+	}
+
+	_, err := h.ew.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the socket.
+func (h *journaldHandler) Close() error {
+	h.once.Do(func() {
+		h.closeErr = h.w.conn.Close()
+	})
+
+	return h.closeErr
+}
+
+// splitCaller splits a "file:line" caller into its file and line.
+func splitCaller(v interface{}) (string, string, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return "", "", false
+	}
+
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+
+	if _, err := strconv.Atoi(s[i+1:]); err != nil {
+		return "", "", false
+	}
+
+	return s[:i], s[i+1:], true
+}
+
+// journalFieldName converts a key to a valid journal field name. Field names
+// contain only uppercase letters, digits and underscores, and cannot start
+// with a digit or an underscore.
+func journalFieldName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+
+	name := strings.TrimLeft(string(b), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "X_" + name
+	}
+
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// writeJournalField writes a field in the journald native format. Values
+// containing newlines are written with their length.
+func writeJournalField(buf *buffer, name, value string) {
+	buf.WriteString(name)
+
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	n := uint64(len(value))
+	for i := 0; i < 8; i++ {
+		buf.WriteByte(byte(n >> (8 * i)))
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalWriter writes each entry to journald as a datagram, passing large
+// entries in a file.
+type journalWriter struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+// Write writes an entry.
+func (w *journalWriter) Write(p []byte) (int, error) {
+	_, _, err := w.conn.WriteMsgUnix(p, nil, w.addr)
+	if err == nil {
+		return len(p), nil
+	}
+
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return 0, err
+	}
+
+	if err := sendJournalFile(w.conn, w.addr, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package logged
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// sendJournalFile writes the entry to an unlinked temporary file and passes
+// its descriptor to journald.
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, p []byte) error {
+	f, err := os.CreateTemp("/dev/shm", "journal.")
+	if err != nil {
+		if f, err = os.CreateTemp("", "journal."); err != nil {
+			return fmt.Errorf("log: could not create journal file: %w", err)
+		}
+	}
+	defer f.Close()
+
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("log: could not create journal file: %w", err)
+	}
+
+	if _, err := f.Write(p); err != nil {
+		return fmt.Errorf("log: could not write journal file: %w", err)
+	}
+
+	rights := syscall.UnixRights(int(f.Fd()))
+	if _, _, err := conn.WriteMsgUnix(nil, rights, addr); err != nil {
+		return fmt.Errorf("log: could not pass journal file: %w", err)
+	}
+
+	return nil
+}
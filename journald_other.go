@@ -0,0 +1,13 @@
+//go:build !linux
+
+package logged
+
+import (
+	"errors"
+	"net"
+)
+
+// sendJournalFile is not supported outside of Linux.
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, p []byte) error {
+	return errors.New("log: journal entry too large")
+}
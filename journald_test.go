@@ -0,0 +1,128 @@
+//go:build linux
+
+package logged_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func journalListener(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, path
+}
+
+// readJournalEntry reads an entry, reading it from a passed file if needed.
+func readJournalEntry(t *testing.T, conn *net.UnixConn) string {
+	b := make([]byte, 1<<20)
+	oob := make([]byte, 1024)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(b, oob)
+	assert.NoError(t, err)
+	if oobn == 0 {
+		return string(b[:n])
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	assert.NoError(t, err)
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	assert.NoError(t, err)
+
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+	f.Seek(0, io.SeekStart)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	return string(data)
+}
+
+func TestJournaldHandler(t *testing.T) {
+	conn, path := journalListener(t)
+	h, err := logged.JournaldHandler(logged.JournaldSocket(path), logged.JournaldIdentifier("app"))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	err = h.(logged.FallibleHandler).TryLog("some message", logged.Warn, []interface{}{"foo", "bar", "request-id", 42, "_trusted", true, "1st", 1.5})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "MESSAGE=some message\nPRIORITY=4\nSYSLOG_IDENTIFIER=app\nFOO=bar\nREQUEST_ID=42\nTRUSTED=true\nX_1ST=1.500\n", readJournalEntry(t, conn))
+}
+
+func TestJournaldHandler_Caller(t *testing.T) {
+	conn, path := journalListener(t)
+	h, err := logged.JournaldHandler(logged.JournaldSocket(path), logged.JournaldIdentifier("app"))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{logged.CallerKey, "/src/app/main.go:42"})
+	h.Log("some message", logged.Info, []interface{}{logged.CallerKey, "unknown"})
+
+	assert.Equal(t, "MESSAGE=some message\nPRIORITY=6\nSYSLOG_IDENTIFIER=app\nCODE_FILE=/src/app/main.go\nCODE_LINE=42\n", readJournalEntry(t, conn))
+	assert.Equal(t, "MESSAGE=some message\nPRIORITY=6\nSYSLOG_IDENTIFIER=app\nCALLER=unknown\n", readJournalEntry(t, conn))
+}
+
+func TestJournaldHandler_MultilineValues(t *testing.T) {
+	conn, path := journalListener(t)
+	h, err := logged.JournaldHandler(logged.JournaldSocket(path), logged.JournaldIdentifier(""))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some\nmessage", logged.Error, []interface{}{"err", errors.Join(errors.New("a"), errors.New("b"))})
+
+	assert.Equal(t,
+		"MESSAGE\n\x0c\x00\x00\x00\x00\x00\x00\x00some\nmessage\nPRIORITY=3\nERR\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nERR_CAUSES=a; b\n",
+		readJournalEntry(t, conn),
+	)
+}
+
+func TestJournaldHandler_LargeEntry(t *testing.T) {
+	conn, path := journalListener(t)
+	h, err := logged.JournaldHandler(logged.JournaldSocket(path), logged.JournaldIdentifier("app"))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	msg := strings.Repeat("a", 512*1024)
+	err = h.(logged.FallibleHandler).TryLog(msg, logged.Info, []interface{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "MESSAGE="+msg+"\nPRIORITY=6\nSYSLOG_IDENTIFIER=app\n", readJournalEntry(t, conn))
+}
+
+func TestJournaldHandler_ReportsErrors(t *testing.T) {
+	var errs []error
+	h, err := logged.JournaldHandler(
+		logged.JournaldSocket(filepath.Join(t.TempDir(), "missing.sock")),
+		logged.JournaldErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	assert.Len(t, errs, 1)
+}
+
+func TestJournaldHandler_CloseIsIdempotent(t *testing.T) {
+	_, path := journalListener(t)
+	h, err := logged.JournaldHandler(logged.JournaldSocket(path))
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.(io.Closer).Close())
+	assert.NoError(t, h.(io.Closer).Close())
+}
@@ -1,8 +1,8 @@
 package logged
 
 import (
+	"context"
 	"fmt"
-	"io"
 )
 
 const errorKey = "LOGGED_ERROR"
@@ -101,8 +101,13 @@ type Logger interface {
 	// Crit logs a critical message.
 	Crit(msg string, ctx ...interface{})
 
+	// Sync flushes any buffered messages.
+	Sync() error
 	// Close closes the logger.
 	Close() error
+	// Shutdown closes the logger, waiting for buffered messages to be
+	// written until the context is done.
+	Shutdown(ctx context.Context) error
 }
 
 type logger struct {
@@ -144,18 +149,29 @@ func (l *logger) Crit(msg string, ctx ...interface{}) {
 }
 
 func (l *logger) write(msg string, lvl Level, ctx []interface{}) {
+	if !enabled(l.h, lvl) {
+		return
+	}
+
 	ctx = normalize(ctx)
 
-	l.h.Log(msg, lvl, merge(l.ctx, ctx))
+	l.h.Log(msg, lvl, withErrorFields(merge(l.ctx, ctx)))
+}
+
+// Sync flushes any buffered messages.
+func (l *logger) Sync() error {
+	return tryFlush(l.h)
 }
 
 // Close closes the logger.
 func (l *logger) Close() error {
-	if h, ok := l.h.(io.Closer); ok {
-		return h.Close()
-	}
+	return tryClose(l.h)
+}
 
-	return nil
+// Shutdown closes the logger, waiting for buffered messages to be
+// written until the context is done.
+func (l *logger) Shutdown(ctx context.Context) error {
+	return tryShutdown(ctx, l.h)
 }
 
 func normalize(ctx []interface{}) []interface{} {
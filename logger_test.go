@@ -1,6 +1,10 @@
 package logged_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/msales/logged"
@@ -264,6 +268,29 @@ func TestLogger_NormalizesCtx(t *testing.T) {
 	assert.Equal(t, nil, out[1])
 }
 
+func TestLogger_MergesErrorFields(t *testing.T) {
+	var out []interface{}
+	h := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		out = ctx
+	})
+	l := logged.New(h, "a", "b")
+	err := logged.WrapError(errors.New("test"), "c", "d")
+
+	l.Error("test", "err", err)
+
+	assert.Equal(t, []interface{}{"a", "b", "err", err, "c", "d"}, out)
+}
+
+func TestLogger_SkipsDisabledLevels(t *testing.T) {
+	rec := &RecordingHandler{}
+	l := logged.New(logged.LevelFilterHandler(logged.Info, rec))
+
+	l.Debug("test")
+	l.Info("test")
+
+	assert.Len(t, rec.Lines(), 1)
+}
+
 func TestLogger_TriesToCallUnderlyingClose(t *testing.T) {
 	h := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {})
 	l := logged.New(h)
@@ -279,3 +306,42 @@ func TestLogger_CallsUnderlyingClose(t *testing.T) {
 
 	assert.True(t, h.CloseCalled)
 }
+
+func TestLogger_TriesToCallUnderlyingFlush(t *testing.T) {
+	h := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {})
+	l := logged.New(h)
+
+	err := l.Sync()
+
+	assert.NoError(t, err)
+}
+
+func TestLogger_CallsUnderlyingFlush(t *testing.T) {
+	h := &FlushableHandler{}
+	l := logged.New(h)
+
+	l.Sync()
+
+	assert.True(t, h.FlushCalled)
+}
+
+func TestLogger_CallsUnderlyingShutdown(t *testing.T) {
+	h := &CloseableHandler{}
+	l := logged.New(h)
+
+	err := l.Shutdown(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, h.CloseCalled)
+}
+
+func TestLogger_TypedNilError(t *testing.T) {
+	var err *nilError
+	var out bytes.Buffer
+	l := logged.New(logged.StreamHandler(&out, logged.LogfmtFormat()))
+
+	assert.NotPanics(t, func() {
+		l.Error("some message", "err", err, "wrapped", fmt.Errorf("failed: %w", err))
+	})
+	assert.Equal(t, `lvl=eror msg="some message" err=<nil> wrapped="failed: <nil>" wrapped.causes=<nil>`+"\n", out.String())
+}
@@ -1,6 +1,10 @@
 package logged_test
 
-import "github.com/msales/logged"
+import (
+	"sync"
+
+	"github.com/msales/logged"
+)
 
 type CloseableHandler struct {
 	CloseCalled bool
@@ -12,3 +16,39 @@ func (h *CloseableHandler) Close() error {
 	h.CloseCalled = true
 	return nil
 }
+
+type FlushableHandler struct {
+	FlushCalled bool
+}
+
+func (h *FlushableHandler) Log(msg string, lvl logged.Level, ctx []interface{}) {}
+
+func (h *FlushableHandler) Flush() error {
+	h.FlushCalled = true
+	return nil
+}
+
+type LogLine struct {
+	Msg string
+	Lvl logged.Level
+	Ctx []interface{}
+}
+
+type RecordingHandler struct {
+	mu    sync.Mutex
+	lines []LogLine
+}
+
+func (h *RecordingHandler) Log(msg string, lvl logged.Level, ctx []interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lines = append(h.lines, LogLine{Msg: msg, Lvl: lvl, Ctx: ctx})
+}
+
+func (h *RecordingHandler) Lines() []LogLine {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]LogLine(nil), h.lines...)
+}
@@ -0,0 +1,82 @@
+package logged
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type multiHandler struct {
+	hs []Handler
+}
+
+// MultiHandler returns a handler that writes messages to each of the given
+// handlers in order. A panic in one handler is recovered and reported to the
+// package error handler, so the remaining handlers still receive the message.
+// The handlers must not modify the context.
+func MultiHandler(hs ...Handler) Handler {
+	return &multiHandler{hs: hs}
+}
+
+// Log write the log message.
+func (h *multiHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	for _, child := range h.hs {
+		if !enabled(child, lvl) {
+			continue
+		}
+
+		safeLog(child, msg, lvl, ctx)
+	}
+}
+
+// Enabled returns true if any of the handlers writes messages of the level.
+func (h *multiHandler) Enabled(lvl Level) bool {
+	for _, child := range h.hs {
+		if enabled(child, lvl) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Flush flushes all the handlers.
+func (h *multiHandler) Flush() error {
+	var errs []error
+	for _, child := range h.hs {
+		errs = append(errs, tryFlush(child))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes all the handlers.
+func (h *multiHandler) Close() error {
+	var errs []error
+	for _, child := range h.hs {
+		errs = append(errs, tryClose(child))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shutdown shuts down all the handlers.
+func (h *multiHandler) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, child := range h.hs {
+		errs = append(errs, tryShutdown(ctx, child))
+	}
+
+	return errors.Join(errs...)
+}
+
+// safeLog writes the message to the handler, recovering and reporting any panic.
+func safeLog(h Handler, msg string, lvl Level, ctx []interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportError(fmt.Errorf("log: handler panicked: %v", r))
+		}
+	}()
+
+	h.Log(msg, lvl, ctx)
+}
@@ -0,0 +1,104 @@
+package logged_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type errorHandler struct {
+	err error
+}
+
+func (h *errorHandler) Log(msg string, lvl logged.Level, ctx []interface{}) {}
+
+func (h *errorHandler) Flush() error {
+	return h.err
+}
+
+func (h *errorHandler) Close() error {
+	return h.err
+}
+
+func TestMultiHandler(t *testing.T) {
+	rec1 := &RecordingHandler{}
+	rec2 := &RecordingHandler{}
+	h := logged.MultiHandler(rec1, logged.LevelFilterHandler(logged.Warn, rec2))
+
+	h.Log("test", logged.Error, []interface{}{"a", 1})
+	h.Log("test", logged.Info, []interface{}{"a", 2})
+
+	assert.Len(t, rec1.Lines(), 2)
+	assert.Len(t, rec2.Lines(), 1)
+}
+
+func TestMultiHandler_RecoversPanics(t *testing.T) {
+	var errs []error
+	logged.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	defer logged.SetErrorHandler(nil)
+
+	rec := &RecordingHandler{}
+	panicHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		panic("test panic")
+	})
+	h := logged.MultiHandler(panicHandler, rec)
+
+	h.Log("test", logged.Error, []interface{}{})
+
+	assert.Len(t, rec.Lines(), 1)
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "log: handler panicked: test panic")
+	}
+}
+
+func TestMultiHandler_Enabled(t *testing.T) {
+	h := logged.MultiHandler(
+		logged.LevelFilterHandler(logged.Error, &RecordingHandler{}),
+		logged.LevelFilterHandler(logged.Warn, &RecordingHandler{}),
+		logged.DiscardHandler(),
+	)
+
+	assert.True(t, h.(logged.Enabler).Enabled(logged.Error))
+	assert.True(t, h.(logged.Enabler).Enabled(logged.Warn))
+	assert.False(t, h.(logged.Enabler).Enabled(logged.Info))
+}
+
+func TestMultiHandler_Close(t *testing.T) {
+	err1 := errors.New("test error 1")
+	err2 := errors.New("test error 2")
+	closeable := &CloseableHandler{}
+	h := logged.MultiHandler(&errorHandler{err: err1}, closeable, &errorHandler{err: err2})
+
+	err := h.(io.Closer).Close()
+
+	assert.ErrorIs(t, err, err1)
+	assert.ErrorIs(t, err, err2)
+	assert.True(t, closeable.CloseCalled)
+}
+
+func TestMultiHandler_Shutdown(t *testing.T) {
+	closeable := &CloseableHandler{}
+	h := logged.MultiHandler(closeable, &RecordingHandler{})
+
+	err := h.(logged.Shutdowner).Shutdown(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, closeable.CloseCalled)
+}
+
+func TestMultiHandler_Flush(t *testing.T) {
+	err1 := errors.New("test error")
+	flushable := &FlushableHandler{}
+	h := logged.MultiHandler(flushable, &errorHandler{err: err1})
+
+	err := h.(logged.Flusher).Flush()
+
+	assert.ErrorIs(t, err, err1)
+	assert.True(t, flushable.FlushCalled)
+}
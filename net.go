@@ -0,0 +1,358 @@
+package logged
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Framing represents how messages are delimited on a stream connection.
+type Framing int
+
+// List of framings.
+const (
+	// FramingOctetCounting prefixes each message with its length.
+	FramingOctetCounting Framing = iota
+	// FramingNewline terminates each message with a newline.
+	FramingNewline
+	// FramingLengthPrefix prefixes each message with its length as a 4 byte
+	// big endian integer.
+	FramingLengthPrefix
+)
+
+// appendFrame appends the framed message to dst. A trailing newline is
+// removed from messages prefixed with their length and added to messages
+// terminated by a newline if missing.
+func appendFrame(dst []byte, framing Framing, p []byte) []byte {
+	switch framing {
+	case FramingNewline:
+		dst = append(dst, p...)
+		if len(p) == 0 || p[len(p)-1] != '\n' {
+			dst = append(dst, '\n')
+		}
+		return dst
+
+	case FramingLengthPrefix:
+		p = bytes.TrimSuffix(p, []byte{'\n'})
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(p)))
+		return append(dst, p...)
+
+	default:
+		p = bytes.TrimSuffix(p, []byte{'\n'})
+		dst = strconv.AppendInt(dst, int64(len(p)), 10)
+		dst = append(dst, ' ')
+		return append(dst, p...)
+	}
+}
+
+// NetStats contains the statistics of a network writer.
+type NetStats struct {
+	// Buffered is the number of bytes waiting for the connection.
+	Buffered int
+	// Dropped is the number of messages dropped due to a full buffer.
+	Dropped uint64
+}
+
+// NetOption represents an option for a network writer.
+type NetOption func(*NetWriter)
+
+// NetFraming sets the framing of messages on stream connections. The default
+// is FramingNewline. Datagram connections send one message per packet.
+func NetFraming(f Framing) NetOption {
+	return func(w *NetWriter) {
+		w.framing = f
+	}
+}
+
+// NetBufferSize sets the maximum number of bytes buffered while the
+// connection is down. When full, the oldest messages are dropped. The default
+// is 1MB. A zero size disables buffering, failing writes instead.
+func NetBufferSize(n int) NetOption {
+	return func(w *NetWriter) {
+		w.bufSize = n
+	}
+}
+
+// NetDialTimeout sets the maximum time to wait for a connection. The default
+// is 5 seconds.
+func NetDialTimeout(d time.Duration) NetOption {
+	return func(w *NetWriter) {
+		w.dialTimeout = d
+	}
+}
+
+// NetWriteTimeout sets the maximum time a write may take. The default is
+// 10 seconds.
+func NetWriteTimeout(d time.Duration) NetOption {
+	return func(w *NetWriter) {
+		w.conn.timeout = d
+	}
+}
+
+// NetBackoff sets the minimum and maximum time to wait before reconnecting
+// after a failed connection. The defaults are 100ms and 30s.
+func NetBackoff(minDelay, maxDelay time.Duration) NetOption {
+	return func(w *NetWriter) {
+		w.conn.minBackoff = minDelay
+		w.conn.maxBackoff = maxDelay
+	}
+}
+
+// NetTLSConfig sets the TLS configuration used by the "tls" network.
+func NetTLSConfig(cfg *tls.Config) NetOption {
+	return func(w *NetWriter) {
+		w.tlsConfig = cfg
+	}
+}
+
+// NetErrorHandler sets the function called when the connection fails. By
+// default errors are reported to the package error handler.
+func NetErrorHandler(fn func(error)) NetOption {
+	return func(w *NetWriter) {
+		w.onError = fn
+	}
+}
+
+// NetWriter is a network writer that connects lazily and reconnects with
+// exponential backoff. Each write is framed as a single message. While the
+// connection is down, messages are buffered up to a bounded size and the
+// number of messages dropped is reported once it is back up.
+//
+// Writers that write whole lines, such as BufferedStreamHandler, can use
+// newline framing to write many messages at once.
+type NetWriter struct {
+	framing     Framing
+	bufSize     int
+	dialTimeout time.Duration
+	tlsConfig   *tls.Config
+	onError     func(error)
+	stream      bool
+
+	conn *netConn
+
+	mu       sync.Mutex
+	backlog  [][]byte
+	buffered int
+	dropped  uint64
+	lost     uint64
+	closed   bool
+}
+
+// NewNetWriter returns a network writer for the address. The network is one
+// of "tcp", "udp", "unix", "unixgram" or "tls".
+func NewNetWriter(network, addr string, opts ...NetOption) (*NetWriter, error) {
+	w := &NetWriter{
+		framing:     FramingNewline,
+		bufSize:     1 << 20,
+		dialTimeout: 5 * time.Second,
+		conn:        newNetConn(nil),
+	}
+	w.conn.timeout = 10 * time.Second
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		w.conn.dial = func() (net.Conn, error) {
+			return net.DialTimeout(network, addr, w.dialTimeout)
+		}
+
+	case "tcp", "tcp4", "tcp6", "unix":
+		w.stream = true
+		w.conn.dial = func() (net.Conn, error) {
+			return net.DialTimeout(network, addr, w.dialTimeout)
+		}
+
+	case "tls":
+		w.stream = true
+		w.conn.dial = func() (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: w.dialTimeout}, "tcp", addr, w.tlsConfig)
+		}
+
+	default:
+		return nil, fmt.Errorf("log: unsupported network: %s", network)
+	}
+
+	return w, nil
+}
+
+// Write writes p as a single message. If the connection is down, the
+// message is buffered and no error is returned, unless buffering is disabled.
+func (w *NetWriter) Write(p []byte) (int, error) {
+	msg := p
+	if w.stream {
+		msg = appendFrame(nil, w.framing, p)
+	} else {
+		// The caller may reuse p, which is only safe to write directly
+		msg = append([]byte(nil), p...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("log: write to closed connection: %w", net.ErrClosed)
+	}
+
+	if len(w.backlog) > 0 {
+		if err := w.flushBacklog(); err != nil {
+			w.buffer(msg)
+			return len(p), nil
+		}
+	}
+
+	if _, err := w.conn.Write(msg); err != nil {
+		if w.bufSize <= 0 {
+			return 0, err
+		}
+
+		w.report(fmt.Errorf("log: connection failed, buffering messages: %w", err))
+		w.buffer(msg)
+	}
+
+	return len(p), nil
+}
+
+// flushBacklog writes the buffered messages, reporting the number of
+// messages dropped once they are written. It must be called with the lock held.
+func (w *NetWriter) flushBacklog() error {
+	for len(w.backlog) > 0 {
+		if _, err := w.conn.Write(w.backlog[0]); err != nil {
+			return err
+		}
+
+		w.buffered -= len(w.backlog[0])
+		w.backlog[0] = nil
+		w.backlog = w.backlog[1:]
+	}
+	w.backlog = nil
+
+	if w.lost > 0 {
+		w.report(fmt.Errorf("log: dropped %d messages while disconnected", w.lost))
+		w.lost = 0
+	}
+
+	return nil
+}
+
+// buffer adds the message to the backlog, dropping the oldest messages if
+// the buffer is full. It must be called with the lock held.
+func (w *NetWriter) buffer(msg []byte) {
+	if len(msg) > w.bufSize {
+		w.dropped++
+		w.lost++
+		return
+	}
+
+	w.backlog = append(w.backlog, msg)
+	w.buffered += len(msg)
+
+	for w.buffered > w.bufSize {
+		w.buffered -= len(w.backlog[0])
+		w.backlog[0] = nil
+		w.backlog = w.backlog[1:]
+		w.dropped++
+		w.lost++
+	}
+}
+
+func (w *NetWriter) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+		return
+	}
+
+	reportError(err)
+}
+
+// Flush writes the buffered messages, returning an error if the connection
+// is still down.
+func (w *NetWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.backlog) == 0 {
+		return nil
+	}
+
+	return w.flushBacklog()
+}
+
+// Stats returns the statistics of the writer.
+func (w *NetWriter) Stats() NetStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return NetStats{
+		Buffered: w.buffered,
+		Dropped:  w.dropped,
+	}
+}
+
+// Close writes the buffered messages, if the connection is up, and closes
+// the connection. The number of messages left unwritten is reported in
+// the error.
+func (w *NetWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var err error
+	if len(w.backlog) > 0 {
+		if ferr := w.flushBacklog(); ferr != nil {
+			err = fmt.Errorf("log: closed with %d messages unwritten: %w", len(w.backlog), ferr)
+		}
+	}
+
+	if cerr := w.conn.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+type netHandler struct {
+	*streamHandler
+
+	w *NetWriter
+}
+
+// NetHandler returns a handler that writes log messages to a network
+// address with the given format, using a NetWriter.
+func NetHandler(network, addr string, fmtr Formatter, opts ...NetOption) (Handler, error) {
+	w, err := NewNetWriter(network, addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &netHandler{
+		streamHandler: StreamHandler(w, fmtr, StreamErrorHandler(w.onError)).(*streamHandler),
+		w:             w,
+	}, nil
+}
+
+// Flush writes the buffered messages.
+func (h *netHandler) Flush() error {
+	return h.w.Flush()
+}
+
+// Stats returns the statistics of the handler.
+func (h *netHandler) Stats() NetStats {
+	return h.w.Stats()
+}
+
+// Close closes the connection.
+func (h *netHandler) Close() error {
+	return h.w.Close()
+}
@@ -0,0 +1,227 @@
+package logged_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type errorRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (r *errorRecorder) Record(err error) {
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+func (r *errorRecorder) Errors() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var msgs []string
+	for _, err := range r.errs {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func acceptConn(t *testing.T, ln net.Listener) *bufio.Reader {
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	return bufio.NewReader(conn)
+}
+
+func TestNetHandler_NewlineFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	h, err := logged.NetHandler("tcp", ln.Addr().String(), logged.JSONFormat())
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("first", logged.Info, []interface{}{"foo", "bar"})
+	h.Log("second", logged.Info, []interface{}{})
+
+	r := acceptConn(t, ln)
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, `{"lvl":"info","msg":"first","foo":"bar"}`+"\n", line)
+	line, err = r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, `{"lvl":"info","msg":"second"}`+"\n", line)
+}
+
+func TestNetHandler_LengthPrefixFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	h, err := logged.NetHandler("tcp", ln.Addr().String(), logged.LogfmtFormat(), logged.NetFraming(logged.FramingLengthPrefix))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	r := acceptConn(t, ln)
+	var size uint32
+	assert.NoError(t, binary.Read(r, binary.BigEndian, &size))
+	b := make([]byte, size)
+	_, err = io.ReadFull(r, b)
+	assert.NoError(t, err)
+	assert.Equal(t, `lvl=info msg="some message"`, string(b))
+}
+
+func TestNetHandler_OctetCountingFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	h, err := logged.NetHandler("tcp", ln.Addr().String(), logged.LogfmtFormat(), logged.NetFraming(logged.FramingOctetCounting))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	frame, err := readOctetCounted(acceptConn(t, ln))
+	assert.NoError(t, err)
+	assert.Equal(t, `lvl=info msg="some message"`, frame)
+}
+
+func TestNetHandler_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	h, err := logged.NetHandler("udp", pc.LocalAddr().String(), logged.LogfmtFormat())
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{})
+
+	b := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=info msg=\"some message\"\n", string(b[:n]))
+}
+
+func TestNetHandler_BuffersWhileDisconnected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	errs := &errorRecorder{}
+	h, err := logged.NetHandler("tcp", addr, logged.LogfmtFormat(),
+		logged.NetBufferSize(40),
+		logged.NetBackoff(time.Millisecond, 5*time.Millisecond),
+		logged.NetErrorHandler(errs.Record),
+	)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	assert.NoError(t, h.(logged.FallibleHandler).TryLog("one", logged.Info, []interface{}{}))
+	h.Log("two", logged.Info, []interface{}{})
+	h.Log("three", logged.Info, []interface{}{})
+
+	stats := h.(interface{ Stats() logged.NetStats }).Stats()
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.Equal(t, 36, stats.Buffered)
+
+	ln, err = net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	assert.Eventually(t, func() bool {
+		return h.(logged.Flusher).Flush() == nil
+	}, time.Second, 5*time.Millisecond)
+
+	r := acceptConn(t, ln)
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=info msg=two\n", line)
+	line, err = r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=info msg=three\n", line)
+
+	assert.Contains(t, errs.Errors(), "log: dropped 1 messages while disconnected")
+	assert.Equal(t, 0, h.(interface{ Stats() logged.NetStats }).Stats().Buffered)
+}
+
+func TestNetHandler_FailsWithoutBuffer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	errs := &errorRecorder{}
+	h, err := logged.NetHandler("tcp", addr, logged.LogfmtFormat(), logged.NetBufferSize(0), logged.NetErrorHandler(errs.Record))
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	assert.Error(t, h.(logged.FallibleHandler).TryLog("one", logged.Info, []interface{}{}))
+	assert.Len(t, errs.Errors(), 1)
+}
+
+func TestNetWriter_WithBufferedStreamHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	w, err := logged.NewNetWriter("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer w.Close()
+	h := logged.BufferedStreamHandler(w, 2000, time.Hour, logged.LogfmtFormat())
+
+	h.Log("one", logged.Info, []interface{}{})
+	h.Log("two", logged.Info, []interface{}{})
+	h.(io.Closer).Close()
+
+	r := acceptConn(t, ln)
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=info msg=one\n", line)
+	line, err = r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "lvl=info msg=two\n", line)
+}
+
+func TestNetWriter_Close(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w, err := logged.NewNetWriter("tcp", addr, logged.NetErrorHandler(func(error) {}))
+	assert.NoError(t, err)
+
+	w.Write([]byte("one\n"))
+
+	err = w.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "log: closed with 1 messages unwritten")
+	assert.NoError(t, w.Close())
+
+	_, err = w.Write([]byte("two\n"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestNewNetWriter_UnsupportedNetwork(t *testing.T) {
+	_, err := logged.NewNetWriter("sctp", "127.0.0.1:514")
+
+	assert.Error(t, err)
+}
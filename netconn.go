@@ -0,0 +1,139 @@
+package logged
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// netConn is a network connection that reconnects with exponential backoff
+// and jitter when a write fails. Each write is made whole to a single
+// connection.
+type netConn struct {
+	dial       func() (net.Conn, error)
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+
+	mu      sync.Mutex
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+	closed  bool
+}
+
+func newNetConn(dial func() (net.Conn, error)) *netConn {
+	return &netConn{
+		dial:       dial,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+	}
+}
+
+// Write writes p to the connection, connecting first if needed. If the
+// write fails, the connection is reestablished and p is written once more.
+func (c *netConn) Write(p []byte) (int, error) {
+	return c.send(p, nil)
+}
+
+// send writes p to the connection as Write does, then calls reply, if not
+// nil, to read the response of the peer. If reply fails, the connection is
+// reestablished and p is written once more.
+func (c *netConn) send(p []byte, reply func(conn net.Conn) error) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, fmt.Errorf("log: write to closed connection: %w", net.ErrClosed)
+	}
+
+	reconnected := c.conn == nil
+	if err := c.connect(); err != nil {
+		return 0, err
+	}
+
+	n, err := c.write(p, reply)
+	if err == nil || reconnected {
+		return n, err
+	}
+
+	// The connection may have been closed by the peer since the last
+	// write, so the message is retried on a new connection
+	if err := c.connect(); err != nil {
+		return 0, err
+	}
+
+	return c.write(p, reply)
+}
+
+// connect dials if there is no connection and the backoff has passed. It
+// must be called with the lock held.
+func (c *netConn) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+
+	if now := time.Now(); now.Before(c.retryAt) {
+		return fmt.Errorf("log: not connected, retrying in %s", c.retryAt.Sub(now).Round(time.Millisecond))
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		c.backoff = min(max(c.backoff*2, c.minBackoff), c.maxBackoff)
+
+		// Jitter spreads out the reconnects of many clients to one server
+		c.retryAt = time.Now().Add(c.backoff/2 + rand.N(c.backoff/2+1))
+
+		return fmt.Errorf("log: could not connect: %w", err)
+	}
+
+	c.conn = conn
+	c.backoff = 0
+	c.retryAt = time.Time{}
+
+	return nil
+}
+
+// write writes p to the connection and reads the reply, dropping the
+// connection if either fails. It must be called with the lock held.
+func (c *netConn) write(p []byte, reply func(conn net.Conn) error) (int, error) {
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+
+	n, err := writeFull(c.conn, p)
+	if err == nil && reply != nil {
+		err = reply(c.conn)
+	}
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("log: write timed out: %w", err)
+		}
+	}
+
+	return n, err
+}
+
+// Close closes the connection.
+func (c *netConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
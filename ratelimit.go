@@ -0,0 +1,295 @@
+package logged
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyFunc represents a function that returns the key a message is grouped by.
+type KeyFunc func(msg string, lvl Level, ctx []interface{}) string
+
+// KeyByMessage groups messages by their message.
+func KeyByMessage() KeyFunc {
+	return func(msg string, lvl Level, ctx []interface{}) string {
+		return msg
+	}
+}
+
+// KeyByLevel groups messages by their level.
+func KeyByLevel() KeyFunc {
+	return func(msg string, lvl Level, ctx []interface{}) string {
+		return lvl.String()
+	}
+}
+
+// KeyByField groups messages by the value of the given context key.
+func KeyByField(key string) KeyFunc {
+	return func(msg string, lvl Level, ctx []interface{}) string {
+		if v, ok := lookupKey(ctx, key); ok {
+			return stringValue(v)
+		}
+
+		return ""
+	}
+}
+
+// RateLimitOption represents an option for the rate limit handler.
+type RateLimitOption func(*rateLimitHandler)
+
+// RateLimitKey sets the function used to group messages, each group having
+// its own budget. By default all messages share a single budget.
+func RateLimitKey(fn KeyFunc) RateLimitOption {
+	return func(h *rateLimitHandler) {
+		h.key = fn
+	}
+}
+
+// RateLimitMaxKeys sets the maximum number of keys tracked. Once reached, the
+// least recently used keys whose budget has refilled are forgotten to make
+// room. If there are none, messages with new keys share a single budget.
+func RateLimitMaxKeys(n int) RateLimitOption {
+	return func(h *rateLimitHandler) {
+		h.maxKeys = n
+	}
+}
+
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	last    time.Time
+	dropped uint64
+}
+
+// take refills the bucket and takes a token from it, if one is available.
+func (b *tokenBucket) take(now time.Time, rate, burst float64) bool {
+	b.refill(now, rate, burst)
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+}
+
+// limitedKey is the number of messages dropped for a key.
+type limitedKey struct {
+	key     string
+	dropped uint64
+}
+
+type rateLimitHandler struct {
+	h       Handler
+	rate    float64
+	burst   float64
+	key     KeyFunc
+	maxKeys int
+	now     func() time.Time
+
+	mx       sync.Mutex
+	buckets  map[string]*list.Element
+	order    *list.List
+	overflow *tokenBucket
+}
+
+// RateLimitHandler returns a handler that writes at most rate messages per
+// second to the wrapped handler, allowing bursts of up to burst messages.
+// Excess messages are dropped and counted; once messages are allowed again
+// a "rate limited" message carrying the number of dropped messages is written.
+// Counts still pending are written when the handler is flushed or closed.
+//
+// RateLimitHandler panics if the rate is not positive or the burst is less
+// than 1.
+func RateLimitHandler(rate float64, burst int, h Handler, opts ...RateLimitOption) Handler {
+	if !(rate > 0) {
+		panic(fmt.Sprintf("log: non-positive rate limit: %v", rate))
+	}
+	if burst < 1 {
+		panic(fmt.Sprintf("log: invalid rate limit burst: %d", burst))
+	}
+
+	rh := &rateLimitHandler{
+		h:       h,
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: 10000,
+		now:     time.Now,
+		buckets: map[string]*list.Element{},
+		order:   list.New(),
+	}
+
+	for _, opt := range opts {
+		opt(rh)
+	}
+
+	rh.overflow = &tokenBucket{tokens: rh.burst, last: rh.now()}
+
+	return rh
+}
+
+// Log write the log message.
+func (h *rateLimitHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	var key string
+	if h.key != nil {
+		key = h.key(msg, lvl, ctx)
+	}
+
+	h.mx.Lock()
+	now := h.now()
+	b, evicted := h.bucket(key, now)
+	allowed := b.take(now, h.rate, h.burst)
+	var dropped uint64
+	if allowed {
+		dropped, b.dropped = b.dropped, 0
+	} else {
+		b.dropped++
+	}
+	h.mx.Unlock()
+
+	h.summarise(evicted)
+
+	if !allowed {
+		return
+	}
+
+	if dropped > 0 {
+		h.limited(b.key, dropped)
+	}
+
+	h.h.Log(msg, lvl, ctx)
+}
+
+// bucket returns the bucket for the key, creating it if needed, and the
+// counts of the buckets evicted to make room for it. It must be called with
+// the lock held.
+func (h *rateLimitHandler) bucket(key string, now time.Time) (*tokenBucket, []limitedKey) {
+	if elem, ok := h.buckets[key]; ok {
+		h.order.MoveToBack(elem)
+		return elem.Value.(*tokenBucket), nil
+	}
+
+	var evicted []limitedKey
+	if h.order.Len() >= h.maxKeys {
+		evicted = h.evict(now)
+
+		if h.order.Len() >= h.maxKeys {
+			return h.overflow, evicted
+		}
+	}
+
+	b := &tokenBucket{key: key, tokens: h.burst, last: now}
+	h.buckets[key] = h.order.PushBack(b)
+
+	return b, evicted
+}
+
+// evict removes the least recently used buckets that have refilled, making
+// room for a new bucket, and returns their dropped counts. Buckets that have
+// not refilled are kept, so a key cannot reset its budget by making room. It
+// must be called with the lock held.
+func (h *rateLimitHandler) evict(now time.Time) []limitedKey {
+	var evicted []limitedKey
+	for h.order.Len() > 0 && h.order.Len() >= h.maxKeys {
+		elem := h.order.Front()
+		b := elem.Value.(*tokenBucket)
+
+		b.refill(now, h.rate, h.burst)
+		if b.tokens < h.burst {
+			break
+		}
+
+		h.order.Remove(elem)
+		delete(h.buckets, b.key)
+
+		if b.dropped > 0 {
+			evicted = append(evicted, limitedKey{key: b.key, dropped: b.dropped})
+		}
+	}
+
+	return evicted
+}
+
+// pending returns and resets the dropped counts of all buckets. It must be
+// called with the lock held.
+func (h *rateLimitHandler) pending() []limitedKey {
+	var pending []limitedKey
+	for elem := h.order.Front(); elem != nil; elem = elem.Next() {
+		b := elem.Value.(*tokenBucket)
+		if b.dropped > 0 {
+			pending = append(pending, limitedKey{key: b.key, dropped: b.dropped})
+			b.dropped = 0
+		}
+	}
+
+	if h.overflow.dropped > 0 {
+		pending = append(pending, limitedKey{dropped: h.overflow.dropped})
+		h.overflow.dropped = 0
+	}
+
+	return pending
+}
+
+// summarise writes the number of messages dropped for each key.
+func (h *rateLimitHandler) summarise(keys []limitedKey) {
+	for _, k := range keys {
+		h.limited(k.key, k.dropped)
+	}
+}
+
+// limited writes the number of messages dropped for a key.
+func (h *rateLimitHandler) limited(key string, dropped uint64) {
+	ctx := []interface{}{"dropped", dropped}
+	if h.key != nil {
+		ctx = append(ctx, "key", key)
+	}
+
+	h.h.Log("rate limited", Warn, ctx)
+}
+
+// writePending writes the dropped counts not yet written.
+func (h *rateLimitHandler) writePending() {
+	h.mx.Lock()
+	pending := h.pending()
+	h.mx.Unlock()
+
+	h.summarise(pending)
+}
+
+// Enabled returns true if the wrapped handler writes messages of the level.
+func (h *rateLimitHandler) Enabled(lvl Level) bool {
+	return enabled(h.h, lvl)
+}
+
+// Flush writes the pending dropped counts and flushes the wrapped handler.
+func (h *rateLimitHandler) Flush() error {
+	h.writePending()
+
+	return tryFlush(h.h)
+}
+
+// Close writes the pending dropped counts and closes the wrapped handler.
+func (h *rateLimitHandler) Close() error {
+	h.writePending()
+
+	return tryClose(h.h)
+}
+
+// Shutdown writes the pending dropped counts and shuts down the wrapped handler.
+func (h *rateLimitHandler) Shutdown(ctx context.Context) error {
+	h.writePending()
+
+	return tryShutdown(ctx, h.h)
+}
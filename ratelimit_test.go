@@ -0,0 +1,144 @@
+package logged_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.RateLimitHandler(50, 2, rec)
+
+	for i := 0; i < 5; i++ {
+		h.Log("test", logged.Info, []interface{}{"i", i})
+	}
+
+	assert.Len(t, rec.Lines(), 2)
+
+	time.Sleep(30 * time.Millisecond)
+
+	h.Log("test", logged.Info, []interface{}{"i", 5})
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 4)
+	assert.Equal(t, LogLine{Msg: "rate limited", Lvl: logged.Warn, Ctx: []interface{}{"dropped", uint64(3)}}, lines[2])
+	assert.Equal(t, []interface{}{"i", 5}, lines[3].Ctx)
+}
+
+func TestRateLimitHandler_KeyByField(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.RateLimitHandler(50, 1, rec, logged.RateLimitKey(logged.KeyByField("tenant")))
+
+	h.Log("test", logged.Info, []interface{}{"tenant", "a"})
+	h.Log("test", logged.Info, []interface{}{"tenant", "a"})
+	h.Log("test", logged.Info, []interface{}{"tenant", "b"})
+
+	assert.Len(t, rec.Lines(), 2)
+
+	time.Sleep(30 * time.Millisecond)
+
+	h.Log("test", logged.Info, []interface{}{"tenant", "a"})
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 4)
+	assert.Equal(t, []interface{}{"dropped", uint64(1), "key", "a"}, lines[2].Ctx)
+}
+
+func TestRateLimitHandler_MaxKeys(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.RateLimitHandler(1, 1, rec, logged.RateLimitKey(logged.KeyByMessage()), logged.RateLimitMaxKeys(1))
+
+	h.Log("a", logged.Info, []interface{}{})
+	h.Log("b", logged.Info, []interface{}{})
+	h.Log("c", logged.Info, []interface{}{})
+
+	assert.Len(t, rec.Lines(), 2)
+}
+
+func TestRateLimitHandler_MaxKeysEvictsLeastRecentlyUsed(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.RateLimitHandler(100, 1, rec, logged.RateLimitKey(logged.KeyByMessage()), logged.RateLimitMaxKeys(2))
+
+	h.Log("a", logged.Info, []interface{}{})
+	h.Log("b", logged.Info, []interface{}{})
+	time.Sleep(20 * time.Millisecond)
+	h.Log("a", logged.Info, []interface{}{})
+	h.Log("c", logged.Info, []interface{}{})
+	h.Log("a", logged.Info, []interface{}{})
+
+	assert.Len(t, rec.Lines(), 4)
+}
+
+func TestRateLimitHandler_WritesPendingOnClose(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.RateLimitHandler(1, 1, rec, logged.RateLimitKey(logged.KeyByField("tenant")))
+
+	for i := 0; i < 5; i++ {
+		h.Log("test", logged.Info, []interface{}{"tenant", "a"})
+	}
+
+	assert.NoError(t, h.(io.Closer).Close())
+	assert.NoError(t, h.(io.Closer).Close())
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 2)
+	assert.Equal(t, LogLine{Msg: "rate limited", Lvl: logged.Warn, Ctx: []interface{}{"dropped", uint64(4), "key", "a"}}, lines[1])
+}
+
+func TestRateLimitHandler_WritesPendingOnFlush(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.RateLimitHandler(1, 1, rec)
+
+	h.Log("test", logged.Info, []interface{}{})
+	h.Log("test", logged.Info, []interface{}{})
+
+	assert.NoError(t, h.(logged.Flusher).Flush())
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 2)
+	assert.Equal(t, []interface{}{"dropped", uint64(1)}, lines[1].Ctx)
+}
+
+func TestRateLimitHandler_InvalidConfig(t *testing.T) {
+	assert.Panics(t, func() {
+		logged.RateLimitHandler(0, 1, logged.DiscardHandler())
+	})
+	assert.Panics(t, func() {
+		logged.RateLimitHandler(-1, 1, logged.DiscardHandler())
+	})
+	assert.Panics(t, func() {
+		logged.RateLimitHandler(1, 0, logged.DiscardHandler())
+	})
+}
+
+func TestKeyFuncs(t *testing.T) {
+	ctx := []interface{}{"tenant", "a", "id", 1}
+
+	assert.Equal(t, "test", logged.KeyByMessage()("test", logged.Info, ctx))
+	assert.Equal(t, "info", logged.KeyByLevel()("test", logged.Info, ctx))
+	assert.Equal(t, "a", logged.KeyByField("tenant")("test", logged.Info, ctx))
+	assert.Equal(t, "1", logged.KeyByField("id")("test", logged.Info, ctx))
+	assert.Equal(t, "", logged.KeyByField("none")("test", logged.Info, ctx))
+}
+
+func TestRateLimitHandler_CallsUnderlyingClose(t *testing.T) {
+	testHandler := &CloseableHandler{}
+	h := logged.RateLimitHandler(1, 1, testHandler)
+
+	h.(io.Closer).Close()
+
+	assert.True(t, testHandler.CloseCalled)
+}
+
+func TestRateLimitHandler_CallsUnderlyingFlush(t *testing.T) {
+	testHandler := &FlushableHandler{}
+	h := logged.RateLimitHandler(1, 1, testHandler)
+
+	h.(logged.Flusher).Flush()
+
+	assert.True(t, testHandler.FlushCalled)
+}
@@ -0,0 +1,348 @@
+package logged
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const maxRedactDepth = 10
+
+// List of predefined patterns of sensitive values.
+var (
+	// CardNumberPattern matches payment card numbers. Matches are only
+	// redacted when their digits pass the Luhn check, keeping other long
+	// numbers such as timestamps.
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// BearerTokenPattern matches bearer tokens, as found in authorization headers.
+	BearerTokenPattern = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// DefaultRedactKeys are the key patterns redacted when none are configured.
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "token", "*_token", "api_key", "apikey", "authorization"}
+
+// DefaultRedactPatterns are the value patterns redacted when none are configured.
+var DefaultRedactPatterns = []*regexp.Regexp{CardNumberPattern, EmailPattern, BearerTokenPattern}
+
+// Redactor represents a strategy to replace a sensitive value.
+type Redactor func(s string) string
+
+// MaskRedactor replaces values with "***".
+func MaskRedactor() Redactor {
+	return func(s string) string {
+		return "***"
+	}
+}
+
+// KeepLastRedactor replaces all but the last n characters of values with "***".
+func KeepLastRedactor(n int) Redactor {
+	return func(s string) string {
+		r := []rune(s)
+		if len(r) <= n {
+			return "***"
+		}
+
+		return "***" + string(r[len(r)-n:])
+	}
+}
+
+// HMACRedactor replaces values with their HMAC-SHA256 hash using the given key,
+// keeping equal values correlatable without revealing them.
+func HMACRedactor(key []byte) Redactor {
+	return func(s string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(s))
+
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+}
+
+// RedactOption represents an option for the redact handler.
+type RedactOption func(*redactHandler)
+
+// RedactKeys sets the key patterns whose values are redacted. Patterns are
+// matched case-insensitively using path.Match syntax.
+func RedactKeys(patterns ...string) RedactOption {
+	return func(h *redactHandler) {
+		h.keys = make([]string, len(patterns))
+		for i, p := range patterns {
+			h.keys[i] = strings.ToLower(p)
+		}
+	}
+}
+
+// RedactPatterns sets the patterns redacted from values and messages.
+func RedactPatterns(patterns ...*regexp.Regexp) RedactOption {
+	return func(h *redactHandler) {
+		h.patterns = patterns
+	}
+}
+
+// RedactWith sets the strategy used to replace sensitive values.
+func RedactWith(r Redactor) RedactOption {
+	return func(h *redactHandler) {
+		h.redact = r
+	}
+}
+
+type redactHandler struct {
+	keys     []string
+	patterns []*regexp.Regexp
+	redact   Redactor
+}
+
+// RedactHandler returns a handler that redacts sensitive values before
+// writing messages to the wrapped handler. Values are redacted when their
+// key matches a key pattern, or where they match a value pattern, including
+// within maps, slices and structs. Unexported struct fields can only be
+// redacted as a whole, so they are written as strings.
+func RedactHandler(h Handler, opts ...RedactOption) Handler {
+	rh := &redactHandler{
+		redact:   MaskRedactor(),
+		patterns: DefaultRedactPatterns,
+	}
+	RedactKeys(DefaultRedactKeys...)(rh)
+
+	for _, opt := range opts {
+		opt(rh)
+	}
+
+	return wrapHandler(rh.prepare, h)
+}
+
+// prepare returns the message and context with sensitive values redacted.
+func (h *redactHandler) prepare(msg string, lvl Level, ctx []interface{}) (string, []interface{}, bool) {
+	msg = h.redactString(msg)
+
+	var newCtx []interface{}
+	for i := 0; i+1 < len(ctx); i += 2 {
+		k, _ := ctx[i].(string)
+
+		v, changed := h.redactKeyValue(k, ctx[i+1], 0)
+		if !changed {
+			continue
+		}
+
+		// Never modify the callers context
+		if newCtx == nil {
+			newCtx = make([]interface{}, len(ctx))
+			copy(newCtx, ctx)
+		}
+		newCtx[i+1] = v
+	}
+
+	if newCtx != nil {
+		ctx = newCtx
+	}
+
+	return msg, ctx, true
+}
+
+func (h *redactHandler) matchKey(k string) bool {
+	if k == "" {
+		return false
+	}
+
+	k = strings.ToLower(k)
+	for _, p := range h.keys {
+		if ok, _ := path.Match(p, k); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *redactHandler) redactString(s string) string {
+	for _, re := range h.patterns {
+		if re == CardNumberPattern {
+			s = re.ReplaceAllStringFunc(s, h.redactCardNumber)
+			continue
+		}
+
+		s = re.ReplaceAllStringFunc(s, h.redact)
+	}
+
+	return s
+}
+
+// redactCardNumber redacts the card number if it passes the Luhn check.
+func (h *redactHandler) redactCardNumber(s string) string {
+	if !luhnValid(s) {
+		return s
+	}
+
+	return h.redact(s)
+}
+
+// luhnValid reports whether the digits in s pass the Luhn check, ignoring
+// spaces and dashes.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// redactKeyValue redacts the value of the given key, returning the new
+// value and whether it was changed.
+func (h *redactHandler) redactKeyValue(k string, v interface{}, depth int) (interface{}, bool) {
+	if h.matchKey(k) {
+		if v == nil {
+			return nil, false
+		}
+
+		return h.redact(fmt.Sprint(v)), true
+	}
+
+	return h.redactValue(v, depth)
+}
+
+// redactValue redacts the sensitive parts of a value, returning the new
+// value and whether it was changed. Changed maps and structs are returned
+// as map[string]interface{}, changed slices as []interface{}.
+func (h *redactHandler) redactValue(v interface{}, depth int) (interface{}, bool) {
+	if v == nil || depth > maxRedactDepth {
+		return v, false
+	}
+
+	switch val := v.(type) {
+	case SecretValue:
+		return v, false
+	case string:
+		s := h.redactString(val)
+		return s, s != val
+	case error:
+		msg := errorMessage(val)
+		s := h.redactString(msg)
+		if s == msg {
+			return v, false
+		}
+		return s, true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return v, false
+		}
+		return h.redactValue(rv.Elem().Interface(), depth+1)
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+
+		var changed bool
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+
+			var c bool
+			m[k], c = h.redactKeyValue(k, iter.Value().Interface(), depth+1)
+			changed = changed || c
+		}
+		if !changed {
+			return v, false
+		}
+		return m, true
+
+	case reflect.Struct:
+		var changed bool
+		m := make(map[string]interface{}, rv.NumField())
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			k := fieldName(f)
+			if k == "-" {
+				continue
+			}
+
+			var c bool
+			if f.IsExported() {
+				m[k], c = h.redactKeyValue(k, rv.Field(i).Interface(), depth+1)
+			} else {
+				m[k], c = h.redactUnexported(k, rv.Field(i))
+			}
+			changed = changed || c
+		}
+		if !changed {
+			return v, false
+		}
+		return m, true
+
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+
+		var changed bool
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			var c bool
+			s[i], c = h.redactValue(rv.Index(i).Interface(), depth+1)
+			changed = changed || c
+		}
+		if !changed {
+			return v, false
+		}
+		return s, true
+	}
+
+	return v, false
+}
+
+// redactUnexported redacts the value of an unexported struct field, which
+// can only be read as its formatted string, returning the new value and
+// whether it was changed.
+func (h *redactHandler) redactUnexported(k string, v reflect.Value) (interface{}, bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+
+	s := fmt.Sprintf("%+v", v)
+	if h.matchKey(k) {
+		return h.redact(s), true
+	}
+
+	r := h.redactString(s)
+	return r, r != s
+}
+
+// fieldName returns the name of a struct field, preferring its json tag.
+func fieldName(f reflect.StructField) string {
+	if tag, ok := f.Tag.Lookup("json"); ok {
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name
+		}
+	}
+
+	return f.Name
+}
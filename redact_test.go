@@ -0,0 +1,167 @@
+package logged_test
+
+import (
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactHandler(t *testing.T) {
+	var outMsg string
+	var outCtx []interface{}
+	testHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		outMsg = msg
+		outCtx = ctx
+	})
+	h := logged.RedactHandler(testHandler)
+	ctx := []interface{}{"password", "hunter2", "API_TOKEN", "abc", "user", "bob", "email", "contact bob@example.com"}
+
+	h.Log("card 4111 1111 1111 1111 declined", logged.Info, ctx)
+
+	assert.Equal(t, "card *** declined", outMsg)
+	assert.Equal(t, []interface{}{"password", "***", "API_TOKEN", "***", "user", "bob", "email", "contact ***"}, outCtx)
+	assert.Equal(t, "hunter2", ctx[1])
+}
+
+func TestRedactHandler_IgnoresNonCardNumbers(t *testing.T) {
+	var outMsg string
+	var outCtx []interface{}
+	testHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		outMsg = msg
+		outCtx = ctx
+	})
+	h := logged.RedactHandler(testHandler)
+
+	h.Log("took 1760832000000 ms", logged.Info, []interface{}{"ts", "1760832000123456789", "card", "5500-0000-0000-0004"})
+
+	assert.Equal(t, "took 1760832000000 ms", outMsg)
+	assert.Equal(t, []interface{}{"ts", "1760832000123456789", "card", "***"}, outCtx)
+}
+
+func TestRedactHandler_LeavesCleanCtx(t *testing.T) {
+	var outCtx []interface{}
+	testHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		outCtx = ctx
+	})
+	h := logged.RedactHandler(testHandler)
+	ctx := []interface{}{"user", "bob", "count", 3}
+
+	h.Log("test", logged.Info, ctx)
+
+	assert.Equal(t, &ctx[0], &outCtx[0])
+}
+
+func TestRedactHandler_Nested(t *testing.T) {
+	type db struct {
+		Host     string
+		Password string `json:"pass"`
+	}
+	type config struct {
+		Name  string
+		DB    *db
+		Auth  map[string]interface{}
+		Hosts []string
+	}
+
+	var outCtx []interface{}
+	testHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		outCtx = ctx
+	})
+	h := logged.RedactHandler(testHandler, logged.RedactKeys("pass", "authorization"))
+	cfg := config{
+		Name:  "test",
+		DB:    &db{Host: "localhost", Password: "hunter2"},
+		Auth:  map[string]interface{}{"authorization": "Bearer abc"},
+		Hosts: []string{"a", "bearer xyz"},
+	}
+
+	h.Log("test", logged.Info, []interface{}{"config", cfg})
+
+	want := map[string]interface{}{
+		"Name":  "test",
+		"DB":    map[string]interface{}{"Host": "localhost", "pass": "***"},
+		"Auth":  map[string]interface{}{"authorization": "***"},
+		"Hosts": []interface{}{"a", "***"},
+	}
+	assert.Equal(t, want, outCtx[1])
+}
+
+func TestRedactHandler_UnexportedFields(t *testing.T) {
+	type config struct {
+		Host     string
+		password string
+		port     int
+	}
+
+	var outCtx []interface{}
+	testHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		outCtx = ctx
+	})
+	h := logged.RedactHandler(testHandler)
+
+	h.Log("test", logged.Info, []interface{}{"cfg", config{Host: "h", password: "hunter2", port: 5432}})
+
+	want := map[string]interface{}{
+		"Host":     "h",
+		"password": "***",
+		"port":     "5432",
+	}
+	assert.Equal(t, want, outCtx[1])
+}
+
+func TestRedactHandler_Options(t *testing.T) {
+	var outMsg string
+	var outCtx []interface{}
+	testHandler := logged.HandlerFunc(func(msg string, lvl logged.Level, ctx []interface{}) {
+		outMsg = msg
+		outCtx = ctx
+	})
+	h := logged.RedactHandler(
+		testHandler,
+		logged.RedactKeys("*_id"),
+		logged.RedactPatterns(regexp.MustCompile(`secret`)),
+		logged.RedactWith(logged.KeepLastRedactor(2)),
+	)
+
+	h.Log("a secret", logged.Info, []interface{}{"card_id", 123456, "password", "foo"})
+
+	assert.Equal(t, "a ***et", outMsg)
+	assert.Equal(t, []interface{}{"card_id", "***56", "password", "foo"}, outCtx)
+}
+
+func TestKeepLastRedactor(t *testing.T) {
+	r := logged.KeepLastRedactor(4)
+
+	assert.Equal(t, "***5678", r("12345678"))
+	assert.Equal(t, "***", r("1234"))
+}
+
+func TestHMACRedactor(t *testing.T) {
+	r := logged.HMACRedactor([]byte("key"))
+
+	assert.Equal(t, r("value"), r("value"))
+	assert.NotEqual(t, r("value"), r("other"))
+	assert.NotEqual(t, r("value"), logged.HMACRedactor([]byte("other"))("value"))
+	assert.Regexp(t, `^hmac:[0-9a-f]{32}$`, r("value"))
+}
+
+func TestRedactHandler_CallsUnderlyingClose(t *testing.T) {
+	testHandler := &CloseableHandler{}
+	h := logged.RedactHandler(testHandler)
+
+	h.(io.Closer).Close()
+
+	assert.True(t, testHandler.CloseCalled)
+}
+
+func TestRedactHandler_CallsUnderlyingFlush(t *testing.T) {
+	testHandler := &FlushableHandler{}
+	h := logged.RedactHandler(testHandler)
+
+	h.(logged.Flusher).Flush()
+
+	assert.True(t, testHandler.FlushCalled)
+}
@@ -0,0 +1,210 @@
+package logged
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ReopenOption represents an option for a reopenable file.
+type ReopenOption func(*ReopenFile)
+
+// ReopenSignals sets the signals that cause the file to be reopened. The
+// default is SIGHUP. Calling it without signals disables reopening on signals.
+func ReopenSignals(sigs ...os.Signal) ReopenOption {
+	return func(f *ReopenFile) {
+		f.sigs = sigs
+	}
+}
+
+// ReopenCheckInterval sets the interval at which the path is checked for the
+// file having been renamed or deleted, reopening it if it has. By default
+// the path is not checked.
+func ReopenCheckInterval(d time.Duration) ReopenOption {
+	return func(f *ReopenFile) {
+		f.interval = d
+	}
+}
+
+// ReopenPerm sets the permissions of created files. The default is 0644.
+func ReopenPerm(perm os.FileMode) ReopenOption {
+	return func(f *ReopenFile) {
+		f.perm = perm
+	}
+}
+
+// ReopenFile is a file writer that can reopen its path, allowing the file
+// to be rotated by an external tool such as logrotate. Each write is made
+// whole to a single file, so reopening never splits or interleaves the
+// writes made through a handler.
+type ReopenFile struct {
+	path     string
+	sigs     []os.Signal
+	interval time.Duration
+	perm     os.FileMode
+
+	mu     sync.Mutex
+	f      *os.File
+	info   os.FileInfo
+	closed bool
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewReopenFile opens a reopenable file at path, appending to it if it exists.
+func NewReopenFile(path string, opts ...ReopenOption) (*ReopenFile, error) {
+	f := &ReopenFile{
+		path: path,
+		sigs: []os.Signal{syscall.SIGHUP},
+		perm: 0644,
+		done: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	file, info, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	f.f, f.info = file, info
+
+	var sigCh chan os.Signal
+	if len(f.sigs) > 0 {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, f.sigs...)
+	}
+
+	if sigCh != nil || f.interval > 0 {
+		f.wg.Add(1)
+		go f.run(sigCh)
+	}
+
+	return f, nil
+}
+
+func (f *ReopenFile) open() (*os.File, os.FileInfo, error) {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, f.perm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("log: could not open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("log: could not open log file: %w", err)
+	}
+
+	return file, info, nil
+}
+
+func (f *ReopenFile) run(sigCh chan os.Signal) {
+	defer f.wg.Done()
+
+	if sigCh != nil {
+		defer signal.Stop(sigCh)
+	}
+
+	var tick <-chan time.Time
+	if f.interval > 0 {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-sigCh:
+			if err := f.Reopen(); err != nil {
+				reportError(err)
+			}
+
+		case <-tick:
+			if !f.moved() {
+				continue
+			}
+
+			if err := f.Reopen(); err != nil {
+				reportError(err)
+			}
+
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// moved returns true if the path no longer refers to the open file.
+func (f *ReopenFile) moved() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return !os.SameFile(info, f.info)
+}
+
+// Write writes p to the file.
+func (f *ReopenFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, fmt.Errorf("log: write to closed file: %w", os.ErrClosed)
+	}
+
+	return writeFull(f.f, p)
+}
+
+// Reopen closes the file and opens the path again. If the path cannot be
+// opened, writes continue to the current file.
+func (f *ReopenFile) Reopen() error {
+	file, info, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		file.Close()
+		return fmt.Errorf("log: reopen closed file: %w", os.ErrClosed)
+	}
+
+	old := f.f
+	f.f, f.info = file, info
+	f.mu.Unlock()
+
+	if err := old.Close(); err != nil {
+		return fmt.Errorf("log: could not close log file: %w", err)
+	}
+
+	return nil
+}
+
+// Close stops watching for signals and closes the file.
+func (f *ReopenFile) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+	})
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	return f.f.Close()
+}
@@ -0,0 +1,143 @@
+package logged_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReopenFile_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := logged.NewReopenFile(path, logged.ReopenSignals())
+	assert.NoError(t, err)
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	assert.NoError(t, os.Rename(path, path+".1"))
+	f.Write([]byte("second\n"))
+	assert.NoError(t, f.Reopen())
+	f.Write([]byte("third\n"))
+
+	assert.Equal(t, "first\nsecond\n", readFile(t, path+".1"))
+	assert.Equal(t, "third\n", readFile(t, path))
+}
+
+func TestReopenFile_ReopensOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := logged.NewReopenFile(path, logged.ReopenSignals(syscall.SIGHUP))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	assert.NoError(t, os.Rename(path, path+".1"))
+	p, err := os.FindProcess(os.Getpid())
+	assert.NoError(t, err)
+	assert.NoError(t, p.Signal(syscall.SIGHUP))
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	f.Write([]byte("line\n"))
+	assert.Equal(t, "line\n", readFile(t, path))
+}
+
+func TestReopenFile_ReopensWhenMoved(t *testing.T) {
+	tests := []struct {
+		name string
+		move func(path string) error
+	}{
+		{
+			name: "Renamed",
+			move: func(path string) error { return os.Rename(path, path+".1") },
+		},
+		{
+			name: "Deleted",
+			move: os.Remove,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			f, err := logged.NewReopenFile(path, logged.ReopenSignals(), logged.ReopenCheckInterval(time.Millisecond))
+			assert.NoError(t, err)
+			defer f.Close()
+
+			assert.NoError(t, tt.move(path))
+
+			assert.Eventually(t, func() bool {
+				_, err := os.Stat(path)
+				return err == nil
+			}, time.Second, time.Millisecond)
+
+			f.Write([]byte("line\n"))
+			assert.Equal(t, "line\n", readFile(t, path))
+		})
+	}
+}
+
+func TestReopenFile_ConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := logged.NewReopenFile(path, logged.ReopenSignals())
+	assert.NoError(t, err)
+	h := logged.StreamHandler(f, logged.LogfmtFormat())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Log("some message", logged.Info, []interface{}{"writer", i, "n", j})
+			}
+		}(i)
+	}
+
+	for i := 1; i <= 5; i++ {
+		os.Rename(path, fmt.Sprintf("%s.%d", path, i))
+		assert.NoError(t, f.Reopen())
+	}
+	wg.Wait()
+	assert.NoError(t, f.Close())
+
+	files, err := filepath.Glob(path + "*")
+	assert.NoError(t, err)
+
+	var lines []string
+	for _, file := range files {
+		lines = append(lines, strings.Split(strings.TrimSuffix(readFile(t, file), "\n"), "\n")...)
+	}
+
+	var count int
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		count++
+		assert.Regexp(t, `^lvl=info msg="some message" writer=\d n=\d+$`, line)
+	}
+	assert.Equal(t, 400, count)
+}
+
+func TestReopenFile_WriteAfterClose(t *testing.T) {
+	f, err := logged.NewReopenFile(filepath.Join(t.TempDir(), "app.log"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, f.Close())
+	assert.NoError(t, f.Close())
+
+	_, err = f.Write([]byte("line\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.ErrorIs(t, f.Reopen(), os.ErrClosed)
+}
@@ -0,0 +1,66 @@
+package logged
+
+import (
+	"sort"
+)
+
+// LevelRoute represents a route of a level router.
+type LevelRoute struct {
+	// MaxLevel is the least severe level routed to the handler.
+	MaxLevel Level
+	// Handler is the handler messages are written to.
+	Handler Handler
+}
+
+type levelRouter struct {
+	*multiHandler
+
+	routes []LevelRoute
+}
+
+// LevelRouter returns a handler that writes each message to a single route.
+// Routes are ordered by severity, and a message is written to the first
+// route whose level it is at or above, so each route covers the levels from
+// the previous route down to its own. Messages below all routes are discarded.
+//
+//	logged.LevelRouter(
+//	    logged.LevelRoute{MaxLevel: logged.Error, Handler: stderr},
+//	    logged.LevelRoute{MaxLevel: logged.Info, Handler: stdout},
+//	)
+func LevelRouter(routes ...LevelRoute) Handler {
+	routes = append([]LevelRoute(nil), routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].MaxLevel < routes[j].MaxLevel
+	})
+
+	hs := make([]Handler, len(routes))
+	for i, r := range routes {
+		hs[i] = r.Handler
+	}
+
+	return &levelRouter{
+		multiHandler: &multiHandler{hs: hs},
+		routes:       routes,
+	}
+}
+
+// Log write the log message.
+func (h *levelRouter) Log(msg string, lvl Level, ctx []interface{}) {
+	for _, r := range h.routes {
+		if lvl <= r.MaxLevel {
+			r.Handler.Log(msg, lvl, ctx)
+			return
+		}
+	}
+}
+
+// Enabled returns true if the route of the level writes messages of the level.
+func (h *levelRouter) Enabled(lvl Level) bool {
+	for _, r := range h.routes {
+		if lvl <= r.MaxLevel {
+			return enabled(r.Handler, lvl)
+		}
+	}
+
+	return false
+}
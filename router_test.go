@@ -0,0 +1,72 @@
+package logged_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelRouter(t *testing.T) {
+	stderr := &RecordingHandler{}
+	stdout := &RecordingHandler{}
+	h := logged.LevelRouter(
+		logged.LevelRoute{MaxLevel: logged.Info, Handler: stdout},
+		logged.LevelRoute{MaxLevel: logged.Error, Handler: stderr},
+	)
+
+	h.Log("crit", logged.Crit, []interface{}{})
+	h.Log("error", logged.Error, []interface{}{})
+	h.Log("warn", logged.Warn, []interface{}{})
+	h.Log("info", logged.Info, []interface{}{})
+	h.Log("debug", logged.Debug, []interface{}{})
+
+	assert.Equal(t, []string{"crit", "error"}, msgs(stderr.Lines()))
+	assert.Equal(t, []string{"warn", "info"}, msgs(stdout.Lines()))
+}
+
+func TestLevelRouter_Enabled(t *testing.T) {
+	h := logged.LevelRouter(
+		logged.LevelRoute{MaxLevel: logged.Error, Handler: &RecordingHandler{}},
+		logged.LevelRoute{MaxLevel: logged.Info, Handler: logged.DiscardHandler()},
+	)
+
+	assert.True(t, h.(logged.Enabler).Enabled(logged.Crit))
+	assert.True(t, h.(logged.Enabler).Enabled(logged.Error))
+	assert.False(t, h.(logged.Enabler).Enabled(logged.Warn))
+	assert.False(t, h.(logged.Enabler).Enabled(logged.Debug))
+}
+
+func TestLevelRouter_CallsUnderlyingClose(t *testing.T) {
+	h1 := &CloseableHandler{}
+	h2 := &CloseableHandler{}
+	h := logged.LevelRouter(
+		logged.LevelRoute{MaxLevel: logged.Error, Handler: h1},
+		logged.LevelRoute{MaxLevel: logged.Info, Handler: logged.LevelFilterHandler(logged.Info, h2)},
+	)
+
+	h.(io.Closer).Close()
+
+	assert.True(t, h1.CloseCalled)
+	assert.True(t, h2.CloseCalled)
+}
+
+func TestLevelRouter_CallsUnderlyingShutdown(t *testing.T) {
+	h1 := &CloseableHandler{}
+	h := logged.LevelRouter(logged.LevelRoute{MaxLevel: logged.Error, Handler: h1})
+
+	h.(logged.Shutdowner).Shutdown(context.Background())
+
+	assert.True(t, h1.CloseCalled)
+}
+
+func TestLevelRouter_CallsUnderlyingFlush(t *testing.T) {
+	h1 := &FlushableHandler{}
+	h := logged.LevelRouter(logged.LevelRoute{MaxLevel: logged.Error, Handler: h1})
+
+	h.(logged.Flusher).Flush()
+
+	assert.True(t, h1.FlushCalled)
+}
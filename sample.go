@@ -0,0 +1,279 @@
+package logged
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const samplingTableSize = 4096
+
+// SamplingOption represents an option for the sampling handler.
+type SamplingOption func(*samplingHandler)
+
+// SamplingTick sets the period in which messages are counted, and at which
+// the dropped messages are summarised. The period must be positive.
+func SamplingTick(d time.Duration) SamplingOption {
+	return func(h *samplingHandler) {
+		h.tick = d
+	}
+}
+
+// SamplingFirst sets the number of messages let through per tick before sampling.
+func SamplingFirst(n uint64) SamplingOption {
+	return func(h *samplingHandler) {
+		h.first = n
+	}
+}
+
+// SamplingThereafter sets the sample rate once the first messages have been let
+// through, letting every mth message through.
+func SamplingThereafter(m uint64) SamplingOption {
+	return func(h *samplingHandler) {
+		h.thereafter = m
+	}
+}
+
+type samplingCounter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+// inc increments the counter, resetting it if the tick has passed.
+func (c *samplingCounter) inc(now, tick int64) uint64 {
+	resetAt := c.resetAt.Load()
+	if now < resetAt {
+		return c.count.Add(1)
+	}
+
+	if c.resetAt.CompareAndSwap(resetAt, now+tick) {
+		c.count.Store(1)
+		return 1
+	}
+
+	return c.count.Add(1)
+}
+
+type samplingHandler struct {
+	h          Handler
+	tick       time.Duration
+	first      uint64
+	thereafter uint64
+
+	counters [Debug + 1][samplingTableSize]samplingCounter
+	dropped  [Debug + 1]atomic.Uint64
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// SamplingHandler returns a handler that samples repeated messages. Messages
+// are counted per level and message in each tick; the first messages are
+// written to the wrapped handler, then only every mth message. The number of
+// dropped messages per level is written at the end of every tick.
+//
+// Counters are kept in a fixed size table without locking, so distinct
+// messages may occasionally share a counter.
+//
+// SamplingHandler panics if the tick is not positive.
+func SamplingHandler(h Handler, opts ...SamplingOption) Handler {
+	sh := &samplingHandler{
+		h:          h,
+		tick:       time.Second,
+		first:      100,
+		thereafter: 100,
+		done:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(sh)
+	}
+
+	if sh.tick <= 0 {
+		panic(fmt.Sprintf("log: non-positive sampling tick: %s", sh.tick))
+	}
+
+	sh.wg.Add(1)
+	go sh.run()
+
+	return sh
+}
+
+func (h *samplingHandler) run() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.summarise()
+
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Log write the log message.
+func (h *samplingHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	if lvl < Crit || lvl > Debug {
+		h.h.Log(msg, lvl, ctx)
+		return
+	}
+
+	c := &h.counters[lvl][fnv32a(msg)%samplingTableSize]
+
+	n := c.inc(time.Now().UnixNano(), int64(h.tick))
+	if n > h.first && (h.thereafter == 0 || (n-h.first)%h.thereafter != 0) {
+		h.dropped[lvl].Add(1)
+		return
+	}
+
+	h.h.Log(msg, lvl, ctx)
+}
+
+// fnv32a returns the 32-bit FNV-1a hash of s.
+func fnv32a(s string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	hash := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint32(s[i])
+		hash *= prime32
+	}
+
+	return hash
+}
+
+// summarise writes the number of dropped messages per level.
+func (h *samplingHandler) summarise() {
+	for lvl := range h.dropped {
+		if n := h.dropped[lvl].Swap(0); n > 0 {
+			h.h.Log("messages dropped by sampling", Level(lvl), []interface{}{"dropped", n})
+		}
+	}
+}
+
+// Enabled returns true if the wrapped handler writes messages of the level.
+func (h *samplingHandler) Enabled(lvl Level) bool {
+	return enabled(h.h, lvl)
+}
+
+// Flush flushes the wrapped handler.
+func (h *samplingHandler) Flush() error {
+	return tryFlush(h.h)
+}
+
+// Close stops the handler, writing the final summary, and closes the wrapped handler.
+func (h *samplingHandler) Close() error {
+	return h.Shutdown(context.Background())
+}
+
+// Shutdown stops the handler, writing the final summary, and shuts down the wrapped handler.
+func (h *samplingHandler) Shutdown(ctx context.Context) error {
+	h.once.Do(func() {
+		close(h.done)
+		h.wg.Wait()
+
+		h.summarise()
+	})
+
+	return tryShutdown(ctx, h.h)
+}
+
+// HashSampleOption represents an option for the hash sample handler.
+type HashSampleOption func(*hashSampler)
+
+// HashSampleBypass sets the level at or above which messages bypass sampling.
+// By default Error and Crit messages are never sampled.
+func HashSampleBypass(lvl Level) HashSampleOption {
+	return func(s *hashSampler) {
+		s.bypass = lvl
+	}
+}
+
+type hashSampler struct {
+	key       string
+	threshold uint64
+	keepAll   bool
+	bypass    Level
+}
+
+// HashSampleHandler returns a handler that keeps or drops all messages for a
+// given value of the context key, keeping roughly rate (0 to 1) of the values.
+// Messages without the key are always kept.
+//
+// The value is converted to a string, strings and byte slices as is and other
+// values as formatted by fmt.Sprint, hashed with 64-bit FNV-1a and mixed with
+// the MurmurHash3 fmix64 finalizer. A message is kept when the hash, as an
+// unsigned integer, is less than rate * 2^64.
+// Services sampling with the same algorithm and rate keep the same values.
+func HashSampleHandler(key string, rate float64, h Handler, opts ...HashSampleOption) Handler {
+	s := &hashSampler{
+		key:    key,
+		bypass: Error,
+	}
+
+	switch {
+	case rate >= 1:
+		s.keepAll = true
+	case rate > 0:
+		s.threshold = uint64(math.Ldexp(rate, 64))
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return FilterHandler(s.keep, h)
+}
+
+func (s *hashSampler) keep(msg string, lvl Level, ctx []interface{}) bool {
+	if s.keepAll || lvl <= s.bypass {
+		return true
+	}
+
+	v, ok := lookupKey(ctx, s.key)
+	if !ok {
+		return true
+	}
+
+	return fmix64(fnv64a(stringValue(v))) < s.threshold
+}
+
+// fnv64a returns the 64-bit FNV-1a hash of s.
+func fnv64a(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	hash := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= prime64
+	}
+
+	return hash
+}
+
+// fmix64 is the MurmurHash3 64-bit finalizer, spreading every input bit
+// across the hash.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
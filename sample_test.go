@@ -0,0 +1,140 @@
+package logged_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.SamplingHandler(rec, logged.SamplingFirst(2), logged.SamplingThereafter(3))
+
+	for i := 0; i < 10; i++ {
+		h.Log("test", logged.Error, []interface{}{"i", i})
+	}
+	h.Log("other", logged.Error, []interface{}{})
+	h.Log("test", logged.Info, []interface{}{})
+	h.(io.Closer).Close()
+
+	want := []LogLine{
+		{Msg: "test", Lvl: logged.Error, Ctx: []interface{}{"i", 0}},
+		{Msg: "test", Lvl: logged.Error, Ctx: []interface{}{"i", 1}},
+		{Msg: "test", Lvl: logged.Error, Ctx: []interface{}{"i", 4}},
+		{Msg: "test", Lvl: logged.Error, Ctx: []interface{}{"i", 7}},
+		{Msg: "other", Lvl: logged.Error, Ctx: []interface{}{}},
+		{Msg: "test", Lvl: logged.Info, Ctx: []interface{}{}},
+		{Msg: "messages dropped by sampling", Lvl: logged.Error, Ctx: []interface{}{"dropped", uint64(6)}},
+	}
+	assert.Equal(t, want, rec.Lines())
+}
+
+func TestSamplingHandler_ResetsEachTick(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.SamplingHandler(rec, logged.SamplingTick(10*time.Millisecond), logged.SamplingFirst(1), logged.SamplingThereafter(0))
+	defer h.(io.Closer).Close()
+
+	h.Log("test", logged.Error, []interface{}{})
+	h.Log("test", logged.Error, []interface{}{})
+
+	time.Sleep(30 * time.Millisecond)
+
+	h.Log("test", logged.Error, []interface{}{})
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "messages dropped by sampling", lines[1].Msg)
+	assert.Equal(t, []interface{}{"dropped", uint64(1)}, lines[1].Ctx)
+}
+
+func TestSamplingHandler_CallsUnderlyingClose(t *testing.T) {
+	testHandler := &CloseableHandler{}
+	h := logged.SamplingHandler(testHandler)
+
+	h.(io.Closer).Close()
+	h.(io.Closer).Close()
+
+	assert.True(t, testHandler.CloseCalled)
+}
+
+func TestSamplingHandler_InvalidTick(t *testing.T) {
+	assert.Panics(t, func() {
+		logged.SamplingHandler(logged.DiscardHandler(), logged.SamplingTick(0))
+	})
+}
+
+func TestHashSampleHandler(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.HashSampleHandler("trace_id", 0.5, rec)
+
+	kept := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("trace-%d", i)
+		before := len(rec.Lines())
+
+		h.Log("test", logged.Info, []interface{}{"trace_id", id})
+		h.Log("test", logged.Debug, []interface{}{"trace_id", id})
+
+		n := len(rec.Lines()) - before
+		assert.Contains(t, []int{0, 2}, n, "Expected all or no messages for a trace")
+		kept[id] = n == 2
+	}
+
+	var count int
+	for _, k := range kept {
+		if k {
+			count++
+		}
+	}
+	assert.InDelta(t, 100, count, 30)
+}
+
+func TestHashSampleHandler_Stable(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.HashSampleHandler("trace_id", 0.5, rec)
+
+	// The hash of "a" is 0x82a2a958a9bece5b, of "b" is 0x6e673288764ad2d0,
+	// of "d" is 0xa595cb3457de825e and of "1" is 0x7c3832dde020d3d6.
+	for _, id := range []interface{}{"a", "b", "d", 1} {
+		h.Log("test", logged.Info, []interface{}{"trace_id", id})
+	}
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "b", lines[0].Ctx[1])
+	assert.Equal(t, 1, lines[1].Ctx[1])
+}
+
+func TestHashSampleHandler_Bypass(t *testing.T) {
+	rec := &RecordingHandler{}
+	h := logged.HashSampleHandler("trace_id", 0, rec)
+
+	h.Log("test", logged.Error, []interface{}{"trace_id", "a"})
+	h.Log("test", logged.Crit, []interface{}{"trace_id", "a"})
+	h.Log("test", logged.Warn, []interface{}{"trace_id", "a"})
+	h.Log("test", logged.Info, []interface{}{"other", "a"})
+
+	assert.Len(t, rec.Lines(), 3)
+
+	rec = &RecordingHandler{}
+	h = logged.HashSampleHandler("trace_id", 0, rec, logged.HashSampleBypass(logged.Warn))
+
+	h.Log("test", logged.Warn, []interface{}{"trace_id", "a"})
+	h.Log("test", logged.Info, []interface{}{"trace_id", "a"})
+
+	assert.Len(t, rec.Lines(), 1)
+}
+
+func TestSamplingHandler_CallsUnderlyingFlush(t *testing.T) {
+	testHandler := &FlushableHandler{}
+	h := logged.SamplingHandler(testHandler)
+	defer h.(io.Closer).Close()
+
+	h.(logged.Flusher).Flush()
+
+	assert.True(t, testHandler.FlushCalled)
+}
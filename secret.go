@@ -0,0 +1,74 @@
+package logged
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretValue holds a value that is never printed. It is created with Secret
+// or SecretFingerprint.
+type SecretValue struct {
+	// The value is held behind a pointer, which fmt prints as an address
+	// when it cannot call the methods of a SecretValue in an unexported field
+	v           *secretHolder
+	fingerprint bool
+}
+
+type secretHolder struct {
+	v interface{}
+}
+
+// Secret wraps a value so it always renders as "[REDACTED]" in log
+// messages, and when formatted with fmt or encoded as JSON or text.
+func Secret(v interface{}) SecretValue {
+	return SecretValue{v: &secretHolder{v: v}}
+}
+
+// SecretFingerprint wraps a value so it always renders as "[REDACTED:<fp>]",
+// where fp is a short SHA-256 fingerprint of the value. Equal values have equal
+// fingerprints, so low-entropy values should not use a fingerprint.
+func SecretFingerprint(v interface{}) SecretValue {
+	return SecretValue{v: &secretHolder{v: v}, fingerprint: true}
+}
+
+// Reveal returns the wrapped value.
+func (s SecretValue) Reveal() interface{} {
+	if s.v == nil {
+		return nil
+	}
+
+	return s.v.v
+}
+
+// String returns the redacted representation of the value.
+func (s SecretValue) String() string {
+	if !s.fingerprint {
+		return redacted
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprint(s.Reveal())))
+	return "[REDACTED:" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+// GoString returns the redacted representation of the value.
+func (s SecretValue) GoString() string {
+	return s.String()
+}
+
+// Format implements fmt.Formatter, writing the redacted representation for every verb.
+func (s SecretValue) Format(f fmt.State, verb rune) {
+	f.Write([]byte(s.String()))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s SecretValue) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s SecretValue) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,68 @@
+package logged_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	s := logged.Secret("hunter2")
+
+	assert.Equal(t, "hunter2", s.Reveal())
+	assert.Equal(t, "[REDACTED]", s.String())
+	assert.Equal(t, "[REDACTED]", fmt.Sprintf("%v", s))
+	assert.Equal(t, "[REDACTED]", fmt.Sprintf("%+v", s))
+	assert.Equal(t, "[REDACTED]", fmt.Sprintf("%#v", s))
+	assert.Equal(t, "[REDACTED]", fmt.Sprintf("%s", s))
+	assert.Equal(t, "[REDACTED]", fmt.Sprintf("%x", s))
+}
+
+func TestSecret_Nested(t *testing.T) {
+	cfg := struct {
+		User     string
+		Password logged.SecretValue
+	}{User: "bob", Password: logged.Secret("hunter2")}
+
+	assert.Equal(t, "{User:bob Password:[REDACTED]}", fmt.Sprintf("%+v", cfg))
+
+	b, err := json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"User":"bob","Password":"[REDACTED]"}`, string(b))
+}
+
+func TestSecret_UnexportedField(t *testing.T) {
+	type creds struct {
+		pw logged.SecretValue
+	}
+	cfg := struct {
+		Name  string
+		pw    logged.SecretValue
+		creds creds
+	}{Name: "x", pw: logged.Secret("hunter2"), creds: creds{pw: logged.SecretFingerprint("hunter2")}}
+	ctx := []interface{}{"cfg", cfg}
+
+	assert.NotContains(t, fmt.Sprintf("%+v", cfg), "hunter2")
+	assert.NotContains(t, fmt.Sprintf("%#v", cfg), "hunter2")
+	assert.NotContains(t, string(logged.JSONFormat().Format("", logged.Info, ctx)), "hunter2")
+	assert.NotContains(t, string(logged.LogfmtFormat().Format("", logged.Info, ctx)), "hunter2")
+	assert.Equal(t, "hunter2", cfg.pw.Reveal())
+}
+
+func TestSecretFingerprint(t *testing.T) {
+	s := logged.SecretFingerprint("hunter2")
+
+	assert.Regexp(t, `^\[REDACTED:[0-9a-f]{8}\]$`, s.String())
+	assert.Equal(t, s.String(), logged.SecretFingerprint("hunter2").String())
+	assert.NotEqual(t, s.String(), logged.SecretFingerprint("hunter3").String())
+}
+
+func TestSecret_Formats(t *testing.T) {
+	ctx := []interface{}{"password", logged.Secret("hunter2")}
+
+	assert.Equal(t, `{"lvl":"info","msg":"","password":"[REDACTED]"}`+"\n", string(logged.JSONFormat().Format("", logged.Info, ctx)))
+	assert.Equal(t, `lvl=info msg= password=[REDACTED]`+"\n", string(logged.LogfmtFormat().Format("", logged.Info, ctx)))
+}
@@ -0,0 +1,442 @@
+package logged
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Facility represents a syslog facility.
+type Facility int
+
+// List of syslog facilities.
+const (
+	FacilityKern     Facility = 0
+	FacilityUser     Facility = 1
+	FacilityMail     Facility = 2
+	FacilityDaemon   Facility = 3
+	FacilityAuth     Facility = 4
+	FacilitySyslog   Facility = 5
+	FacilityLpr      Facility = 6
+	FacilityNews     Facility = 7
+	FacilityUucp     Facility = 8
+	FacilityCron     Facility = 9
+	FacilityAuthPriv Facility = 10
+	FacilityFtp      Facility = 11
+	FacilityLocal0   Facility = 16
+	FacilityLocal1   Facility = 17
+	FacilityLocal2   Facility = 18
+	FacilityLocal3   Facility = 19
+	FacilityLocal4   Facility = 20
+	FacilityLocal5   Facility = 21
+	FacilityLocal6   Facility = 22
+	FacilityLocal7   Facility = 23
+)
+
+// SyslogProtocol represents the syslog message format.
+type SyslogProtocol int
+
+// List of syslog message formats.
+const (
+	RFC5424 SyslogProtocol = iota
+	RFC3164
+)
+
+// SyslogOption represents an option for the syslog handler.
+type SyslogOption func(*syslogHandler)
+
+// SyslogFormat sets the message format. The default is RFC5424.
+func SyslogFormat(p SyslogProtocol) SyslogOption {
+	return func(h *syslogHandler) {
+		h.protocol = p
+	}
+}
+
+// SyslogFraming sets the framing used on stream connections, either
+// FramingOctetCounting, the default, or FramingNewline. Datagram connections
+// send one message per packet.
+func SyslogFraming(f Framing) SyslogOption {
+	return func(h *syslogHandler) {
+		h.framing = f
+	}
+}
+
+// SyslogFacility sets the facility of messages. The default is FacilityUser.
+func SyslogFacility(f Facility) SyslogOption {
+	return func(h *syslogHandler) {
+		h.facility = f
+	}
+}
+
+// SyslogHostname sets the hostname of messages. The default is the hostname
+// reported by the kernel.
+func SyslogHostname(name string) SyslogOption {
+	return func(h *syslogHandler) {
+		h.hostname = name
+	}
+}
+
+// SyslogAppName sets the app name of messages. The default is the name of
+// the program.
+func SyslogAppName(name string) SyslogOption {
+	return func(h *syslogHandler) {
+		h.appName = name
+	}
+}
+
+// SyslogProcID sets the process id of messages. The default is the pid.
+func SyslogProcID(id string) SyslogOption {
+	return func(h *syslogHandler) {
+		h.procID = id
+	}
+}
+
+// SyslogMsgID sets the message id of RFC5424 messages.
+func SyslogMsgID(id string) SyslogOption {
+	return func(h *syslogHandler) {
+		h.msgID = id
+	}
+}
+
+// SyslogSDID sets the id of the structured data element holding the context
+// of RFC5424 messages. The default is "ctx@32473".
+func SyslogSDID(id string) SyslogOption {
+	return func(h *syslogHandler) {
+		h.sdID = id
+	}
+}
+
+// SyslogTLSConfig sets the TLS configuration used by the "tls" network.
+func SyslogTLSConfig(cfg *tls.Config) SyslogOption {
+	return func(h *syslogHandler) {
+		h.tlsConfig = cfg
+	}
+}
+
+// SyslogDialTimeout sets the maximum time to wait for a connection. The
+// default is 5 seconds.
+func SyslogDialTimeout(d time.Duration) SyslogOption {
+	return func(h *syslogHandler) {
+		h.dialTimeout = d
+	}
+}
+
+// SyslogWriteTimeout sets the maximum time a write may take.
+func SyslogWriteTimeout(d time.Duration) SyslogOption {
+	return func(h *syslogHandler) {
+		h.conn.timeout = d
+	}
+}
+
+// SyslogBackoff sets the minimum and maximum time to wait before
+// reconnecting after a failed connection. The defaults are 100ms and 30s.
+func SyslogBackoff(minDelay, maxDelay time.Duration) SyslogOption {
+	return func(h *syslogHandler) {
+		h.conn.minBackoff = minDelay
+		h.conn.maxBackoff = maxDelay
+	}
+}
+
+// SyslogErrorHandler sets the function called when a write fails. By default
+// errors are reported to the package error handler.
+func SyslogErrorHandler(fn func(error)) SyslogOption {
+	return func(h *syslogHandler) {
+		h.w.onError = fn
+	}
+}
+
+var syslogPool = newPool(512)
+
+type syslogHandler struct {
+	protocol    SyslogProtocol
+	framing     Framing
+	facility    Facility
+	hostname    string
+	appName     string
+	procID      string
+	msgID       string
+	sdID        string
+	dialTimeout time.Duration
+	tlsConfig   *tls.Config
+	stream      bool
+
+	conn *netConn
+	w    *errWriter
+}
+
+// SyslogHandler returns a handler that writes log messages to a syslog
+// server. The network is one of "udp", "tcp", "tls", "unix" or "unixgram".
+// The connection is made on the first message and reestablished with
+// backoff when it fails.
+func SyslogHandler(network, addr string, opts ...SyslogOption) (Handler, error) {
+	hostname, _ := os.Hostname()
+
+	h := &syslogHandler{
+		protocol:    RFC5424,
+		framing:     FramingOctetCounting,
+		facility:    FacilityUser,
+		hostname:    hostname,
+		appName:     filepath.Base(os.Args[0]),
+		procID:      strconv.Itoa(os.Getpid()),
+		sdID:        "ctx@32473",
+		dialTimeout: 5 * time.Second,
+	}
+	h.conn = newNetConn(nil)
+	h.w = &errWriter{w: h.conn}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		h.conn.dial = func() (net.Conn, error) {
+			return net.DialTimeout(network, addr, h.dialTimeout)
+		}
+
+	case "tcp", "tcp4", "tcp6", "unix":
+		h.stream = true
+		h.conn.dial = func() (net.Conn, error) {
+			return net.DialTimeout(network, addr, h.dialTimeout)
+		}
+
+	case "tls":
+		h.stream = true
+		h.conn.dial = func() (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: h.dialTimeout}, "tcp", addr, h.tlsConfig)
+		}
+
+	default:
+		return nil, fmt.Errorf("log: unsupported syslog network: %s", network)
+	}
+
+	return h, nil
+}
+
+// Log write the log message.
+func (h *syslogHandler) Log(msg string, lvl Level, ctx []interface{}) {
+	h.TryLog(msg, lvl, ctx)
+}
+
+// TryLog writes the log message, returning an error if it could not be written.
+func (h *syslogHandler) TryLog(msg string, lvl Level, ctx []interface{}) error {
+	buf := syslogPool.Get()
+	defer syslogPool.Put(buf)
+
+	if h.protocol == RFC3164 {
+		h.formatRFC3164(buf, msg, lvl, ctx, time.Now())
+	} else {
+		h.formatRFC5424(buf, msg, lvl, ctx, time.Now())
+	}
+
+	if h.stream {
+		switch h.framing {
+		case FramingNewline:
+			buf.WriteByte('\n')
+		default:
+			frame := syslogPool.Get()
+			defer syslogPool.Put(frame)
+
+			frame.AppendInt(int64(buf.Len()))
+			frame.WriteByte(' ')
+			frame.Write(buf.Bytes())
+			buf = frame
+		}
+	}
+
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+// formatRFC5424 formats a message as described in RFC 5424, adding it to the buffer.
+func (h *syslogHandler) formatRFC5424(buf *buffer, msg string, lvl Level, ctx []interface{}, now time.Time) {
+	buf.WriteByte('<')
+	buf.AppendInt(int64(h.priority(lvl)))
+	buf.WriteString(">1 ")
+	buf.AppendTime(now, "2006-01-02T15:04:05.000000Z07:00")
+	buf.WriteByte(' ')
+	writeSyslogHeaderField(buf, h.hostname, 255)
+	buf.WriteByte(' ')
+	writeSyslogHeaderField(buf, h.appName, 48)
+	buf.WriteByte(' ')
+	writeSyslogHeaderField(buf, h.procID, 128)
+	buf.WriteByte(' ')
+	writeSyslogHeaderField(buf, h.msgID, 32)
+	buf.WriteByte(' ')
+
+	if len(ctx) == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteByte('[')
+		buf.WriteString(h.sdID)
+		for i := 0; i < len(ctx); i += 2 {
+			k, ok := ctx[i].(string)
+			if !ok {
+				h.writeParam(buf, errorKey, formatPlainValue(ctx[i]))
+				continue
+			}
+
+			if err, ok := ctx[i+1].(error); ok {
+				h.writeParam(buf, k, errorMessage(err))
+				if causes := errorCauses(err); len(causes) > 0 {
+					h.writeParam(buf, k+CausesSuffix, strings.Join(causes, "; "))
+				}
+				continue
+			}
+
+			h.writeParam(buf, k, formatPlainValue(ctx[i+1]))
+		}
+		buf.WriteByte(']')
+	}
+
+	if msg != "" {
+		buf.WriteByte(' ')
+		h.writeMessage(buf, msg)
+	}
+}
+
+// formatRFC3164 formats a message as described in RFC 3164, adding it to
+// the buffer. The context is appended to the message in logfmt.
+func (h *syslogHandler) formatRFC3164(buf *buffer, msg string, lvl Level, ctx []interface{}, now time.Time) {
+	buf.WriteByte('<')
+	buf.AppendInt(int64(h.priority(lvl)))
+	buf.WriteByte('>')
+	buf.AppendTime(now, time.Stamp)
+	buf.WriteByte(' ')
+	writeSyslogHeaderField(buf, h.hostname, 255)
+	buf.WriteByte(' ')
+	writeSyslogHeaderField(buf, h.appName, 32)
+	if h.procID != "" {
+		buf.WriteByte('[')
+		writeSyslogHeaderField(buf, h.procID, 128)
+		buf.WriteByte(']')
+	}
+	buf.WriteString(": ")
+	h.writeMessage(buf, msg)
+
+	for i := 0; i < len(ctx); i += 2 {
+		buf.WriteByte(' ')
+
+		k, ok := ctx[i].(string)
+		if !ok {
+			buf.WriteString(errorKey)
+			buf.WriteByte('=')
+			formatLogfmtValue(buf, ctx[i])
+			continue
+		}
+
+		if err, ok := ctx[i+1].(error); ok {
+			formatLogfmtError(buf, k, err)
+			continue
+		}
+
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		formatLogfmtValue(buf, ctx[i+1])
+	}
+}
+
+// writeMessage writes the message, replacing newlines when they would end
+// the frame.
+func (h *syslogHandler) writeMessage(buf *buffer, msg string) {
+	buf.WriteString(h.replaceNewlines(msg))
+}
+
+// writeParam writes a structured data parameter, replacing newlines in its
+// value when they would end the frame.
+func (h *syslogHandler) writeParam(buf *buffer, name, value string) {
+	writeSyslogParam(buf, name, h.replaceNewlines(value))
+}
+
+// replaceNewlines replaces newlines with spaces when newline framing is used.
+func (h *syslogHandler) replaceNewlines(s string) string {
+	if h.stream && h.framing == FramingNewline {
+		return strings.ReplaceAll(s, "\n", " ")
+	}
+
+	return s
+}
+
+// priority returns the syslog priority of the level.
+func (h *syslogHandler) priority(lvl Level) int {
+	return int(h.facility)*8 + syslogSeverity(lvl)
+}
+
+// syslogSeverity returns the syslog severity of the level.
+func syslogSeverity(lvl Level) int {
+	switch lvl {
+	case Crit:
+		return 2
+	case Error:
+		return 3
+	case Warn:
+		return 4
+	case Info:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// writeSyslogHeaderField writes a header field, replacing characters that
+// are not printable ASCII and truncating it to limit bytes. Empty fields are
+// written as "-".
+func writeSyslogHeaderField(buf *buffer, s string, limit int) {
+	if s == "" {
+		buf.WriteByte('-')
+		return
+	}
+
+	if len(s) > limit {
+		s = s[:limit]
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		buf.WriteByte(c)
+	}
+}
+
+// writeSyslogParam writes a structured data parameter, escaping its value.
+func writeSyslogParam(buf *buffer, name, value string) {
+	buf.WriteByte(' ')
+
+	if name == "" {
+		name = "_"
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf.WriteByte(c)
+	}
+
+	buf.WriteString(`="`)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// Close closes the connection.
+func (h *syslogHandler) Close() error {
+	return h.conn.Close()
+}
@@ -0,0 +1,255 @@
+package logged_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+func syslogOptions(opts ...logged.SyslogOption) []logged.SyslogOption {
+	return append([]logged.SyslogOption{
+		logged.SyslogHostname("host"),
+		logged.SyslogAppName("app"),
+		logged.SyslogProcID("123"),
+	}, opts...)
+}
+
+// readOctetCounted reads an octet counted syslog frame.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	n, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	size, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, size)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+// acceptFrames accepts connections on the listener, sending each octet
+// counted frame to the channel.
+func acceptFrames(ln net.Listener) chan string {
+	ch := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				for {
+					frame, err := readOctetCounted(r)
+					if err != nil {
+						return
+					}
+					ch <- frame
+				}
+			}()
+		}
+	}()
+
+	return ch
+}
+
+func receive(t *testing.T, ch chan string) string {
+	select {
+	case s := <-ch:
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return ""
+	}
+}
+
+func TestSyslogHandler_RFC5424(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	ch := acceptFrames(ln)
+
+	h, err := logged.SyslogHandler("tcp", ln.Addr().String(), syslogOptions(logged.SyslogFacility(logged.FacilityLocal0), logged.SyslogMsgID("req"))...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	err = h.(logged.FallibleHandler).TryLog("some message", logged.Error, []interface{}{"foo", "bar", "n", 2, "esc", `a"b\c]d`})
+
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) host app 123 req \[ctx@32473 foo="bar" n="2" esc="a\\"b\\\\c\\]d"\] some message$`, receive(t, ch))
+}
+
+func TestSyslogHandler_RFC5424WithoutContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	ch := acceptFrames(ln)
+
+	h, err := logged.SyslogHandler("tcp", ln.Addr().String(), syslogOptions(logged.SyslogSDID("app@12345"))...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Debug, []interface{}{})
+	h.Log("other message", logged.Warn, []interface{}{"foo", "bar"})
+
+	assert.Regexp(t, ` host app 123 - - some message$`, receive(t, ch))
+	assert.Regexp(t, `^<12>1 .* host app 123 - \[app@12345 foo="bar"\] other message$`, receive(t, ch))
+}
+
+func TestSyslogHandler_RFC5424ErrorCauses(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	ch := acceptFrames(ln)
+
+	h, err := logged.SyslogHandler("tcp", ln.Addr().String(), syslogOptions()...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Error, []interface{}{"err", errors.Join(errors.New("a"), errors.New("b"))})
+
+	assert.Regexp(t, `\[ctx@32473 err="a\nb" err.causes="a; b"\] some message$`, receive(t, ch))
+}
+
+func TestSyslogHandler_RFC3164(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	h, err := logged.SyslogHandler("udp", pc.LocalAddr().String(), syslogOptions(logged.SyslogFormat(logged.RFC3164), logged.SyslogFacility(logged.FacilityDaemon))...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some message", logged.Info, []interface{}{"foo", "bar baz"})
+
+	b := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(b)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<30>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d host app\[123\]: some message foo="bar baz"$`, string(b[:n]))
+}
+
+func TestSyslogHandler_NewlineFraming(t *testing.T) {
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "syslog.sock"))
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	h, err := logged.SyslogHandler("unix", ln.Addr().String(), syslogOptions(logged.SyslogFraming(logged.FramingNewline))...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	h.Log("some\nmessage", logged.Info, []interface{}{})
+	h.Log("other message", logged.Info, []interface{}{"foo", "a\nb"})
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Regexp(t, ` some message\n$`, line)
+	line, err = r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Regexp(t, ` \[ctx@32473 foo="a b"\] other message\n$`, line)
+}
+
+func TestSyslogHandler_TLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	assert.NoError(t, err)
+	defer ln.Close()
+	ch := acceptFrames(ln)
+
+	h, err := logged.SyslogHandler("tls", ln.Addr().String(), syslogOptions(logged.SyslogTLSConfig(&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}))...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	err = h.(logged.FallibleHandler).TryLog("some message", logged.Info, []interface{}{})
+
+	assert.NoError(t, err)
+	assert.Regexp(t, ` some message$`, receive(t, ch))
+}
+
+func TestSyslogHandler_Reconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+
+	var errs []error
+	h, err := logged.SyslogHandler("tcp", addr, syslogOptions(
+		logged.SyslogBackoff(time.Millisecond, 10*time.Millisecond),
+		logged.SyslogErrorHandler(func(err error) { errs = append(errs, err) }),
+	)...)
+	assert.NoError(t, err)
+	defer h.(io.Closer).Close()
+
+	ln.Close()
+	assert.Error(t, h.(logged.FallibleHandler).TryLog("lost", logged.Info, []interface{}{}))
+	assert.NotEmpty(t, errs)
+
+	ln, err = net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	defer ln.Close()
+	ch := acceptFrames(ln)
+
+	assert.Eventually(t, func() bool {
+		return h.(logged.FallibleHandler).TryLog("found", logged.Info, []interface{}{}) == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Regexp(t, ` found$`, receive(t, ch))
+}
+
+func TestSyslogHandler_UnsupportedNetwork(t *testing.T) {
+	_, err := logged.SyslogHandler("sctp", "127.0.0.1:514")
+
+	assert.Error(t, err)
+}
+
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
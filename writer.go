@@ -0,0 +1,84 @@
+package logged
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+var errorHandler atomic.Pointer[func(error)]
+
+// SetErrorHandler sets the function called when a handler fails to write a
+// message and has no error handler of its own. By default errors are discarded.
+func SetErrorHandler(fn func(error)) {
+	if fn == nil {
+		errorHandler.Store(nil)
+		return
+	}
+
+	errorHandler.Store(&fn)
+}
+
+// reportError reports an error to the package error handler.
+func reportError(err error) {
+	if fn := errorHandler.Load(); fn != nil {
+		(*fn)(err)
+	}
+}
+
+// writeFull writes all of p to w, retrying short writes.
+func writeFull(w io.Writer, p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		m, err := w.Write(p[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+
+	return n, nil
+}
+
+// errWriter wraps a writer, reporting failed writes and writing to a
+// fallback writer while the writer is failing.
+type errWriter struct {
+	w        io.Writer
+	fallback io.Writer
+	onError  func(error)
+
+	failed atomic.Uint64
+}
+
+// Write writes all of p to the writer. If the write fails, the error is
+// reported and p is written to the fallback writer, if there is one. The
+// error of the writer is always returned.
+func (w *errWriter) Write(p []byte) (int, error) {
+	n, err := writeFull(w.w, p)
+	if err == nil {
+		return n, nil
+	}
+
+	w.failed.Add(1)
+	w.report(fmt.Errorf("log: write failed after %d of %d bytes: %w", n, len(p), err))
+
+	if w.fallback != nil {
+		if _, ferr := writeFull(w.fallback, p); ferr != nil {
+			w.report(fmt.Errorf("log: fallback write failed: %w", ferr))
+		}
+	}
+
+	return n, err
+}
+
+func (w *errWriter) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+		return
+	}
+
+	reportError(err)
+}
@@ -0,0 +1,100 @@
+package logged_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/msales/logged"
+	"github.com/stretchr/testify/assert"
+)
+
+type shortWriter struct {
+	bytes.Buffer
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > 4 {
+		p = p[:4]
+	}
+
+	return w.Buffer.Write(p)
+}
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return w.n, errors.New("test error")
+}
+
+func TestStreamHandler_ShortWrites(t *testing.T) {
+	w := &shortWriter{}
+	h := logged.StreamHandler(w, logged.LogfmtFormat())
+
+	h.Log("some message", logged.Error, []interface{}{})
+
+	assert.Equal(t, "lvl=eror msg=\"some message\"\n", w.String())
+}
+
+func TestSetErrorHandler(t *testing.T) {
+	var errs []error
+	logged.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	defer logged.SetErrorHandler(nil)
+
+	h := logged.StreamHandler(&failingWriter{n: 3}, logged.LogfmtFormat())
+
+	h.Log("some message", logged.Error, []interface{}{})
+
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "log: write failed after 3 of 28 bytes: test error")
+	}
+}
+
+func TestStreamHandler_ErrorHandler(t *testing.T) {
+	var errs []error
+	h := logged.StreamHandler(&failingWriter{}, logged.LogfmtFormat(), logged.StreamErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	h.Log("some message", logged.Error, []interface{}{})
+	h.Log("some message", logged.Error, []interface{}{})
+
+	assert.Len(t, errs, 2)
+	assert.Equal(t, uint64(2), h.(interface{ Stats() logged.StreamStats }).Stats().FailedWrites)
+}
+
+func TestStreamHandler_Fallback(t *testing.T) {
+	fallback := &bytes.Buffer{}
+	h := logged.StreamHandler(&failingWriter{}, logged.LogfmtFormat(), logged.StreamFallback(fallback), logged.StreamErrorHandler(func(error) {}))
+
+	h.Log("some message", logged.Error, []interface{}{})
+
+	assert.Equal(t, "lvl=eror msg=\"some message\"\n", fallback.String())
+}
+
+func TestBufferedStreamHandler_WriteErrors(t *testing.T) {
+	var errs []error
+	fallback := &bytes.Buffer{}
+	h := logged.BufferedStreamHandler(&failingWriter{}, 2000, time.Second, logged.LogfmtFormat(),
+		logged.BufferedFallback(fallback),
+		logged.BufferedErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+
+	h.Log("some message", logged.Error, []interface{}{})
+	h.(io.Closer).Close()
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "lvl=eror msg=\"some message\"\n", fallback.String())
+
+	stats := h.(interface{ Stats() logged.BufferedStats }).Stats()
+	assert.Equal(t, uint64(1), stats.FailedWrites)
+	assert.Equal(t, uint64(0), stats.WrittenBytes)
+}